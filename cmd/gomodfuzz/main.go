@@ -29,11 +29,11 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
-	tp_algo "github.com/codeactual/gomodfuzz/internal/third_party/stackexchange/algo"
-
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 
@@ -68,6 +68,53 @@ type Handler struct {
 	Stdout  bool `usage:"Display standard output from scenarios that fail"`
 	Verbose bool `usage:"Display additional status/result information"`
 
+	ImportPath string   `usage:"Import path of the working directory's package in GOPATH/src layouts"`
+	Layout     []string `usage:"Permute LAYOUT axis values: flat, gopath_src, gopath_src_mismatch, shadowed"`
+	Goenv      []string `usage:"Permute GOENV axis values: empty, written (default: both if --goenv-set is used)"`
+	GoenvSet   []string `usage:"KEY=VALUE setting, as if from 'go env -w', for the written GOENV axis value (repeatable)"`
+
+	FixtureModules string   `usage:"Directory of fixture modules, each located at <module path>@<version>"`
+	Modcache       []string `usage:"Permute MODCACHE axis values: empty, seeded, readonly"`
+	SharedGocache  bool     `usage:"Share one GOCACHE across all scenarios"`
+	Goproxy        []string `usage:"Permute GOPROXY axis values: off, direct, file, http, unset (default: http if --proxy-fault is used)"`
+	ProxyFault     []string `usage:"Permute PROXY_FAULT axis values: none, 404, 410, slow, truncated_zip, corrupt_zip, sum_mismatch"`
+	Private        []string `usage:"Permute PRIVATE axis values: none, goprivate, gonosumdb, goinsecure, unset"`
+
+	Hermetic bool     `usage:"Run scenarios with only PATH, HOME, TMPDIR, and --pass-env variables inherited from the host"`
+	PassEnv  []string `usage:"Host environment variable names to inherit in --hermetic mode"`
+	Env      []string `usage:"KEY=VALUE variable to add to each scenario's environment (repeatable)"`
+	DdminId  int      `usage:"Find the host environment variables which cause the failure of the scenario with this ID"`
+	UnsetEnv bool     `usage:"Also permute GO111MODULE, GOFLAGS, and GOPATH as unset variables, not just empty or non-empty"`
+
+	InvalidEnv bool `usage:"Also permute GO111MODULE, GOFLAGS, and GOPATH with invalid values, e.g. a relative GOPATH"`
+
+	TemplateArgs bool `usage:"Expand subject arguments as templates of scenario fields and methods, e.g. --root={{.Wd}}"`
+	TemplateEnv  bool `usage:"Expand --env values as templates of scenario fields and methods, e.g. OUT={{.ScenarioDir}}/out.json"`
+
+	Goflag         []string `usage:"Flag from which GOFLAGS axis values are composed, e.g. -mod=mod or -modfile=alt.mod (repeatable)"`
+	GoflagsCompose string   `usage:"How --goflag values are combined: powerset, pairs"`
+
+	Vcs           []string `usage:"Permute VCS axis values: none, clean, dirty, subdir, unsafe"`
+	BuildvcsFalse bool     `usage:"Also permute GOFLAGS values with -buildvcs=false added"`
+
+	GoDirective  []string `usage:"Permute GO_DIRECTIVE axis values: absent, 1.11, 1.14, 1.17, 1.21, newer"`
+	Toolchain    []string `usage:"Permute TOOLCHAIN axis values: absent, newer, newer_local"`
+	PathShape    []string `usage:"Permute PATH_SHAPE axis values: plain, spaces, unicode, symlink_wd, symlink_gopath, long"`
+	SpecialDir   []string `usage:"Permute SPECIAL_DIR axis values: none, pkg, testdata, _x, .x, vendor"`
+	NestedModule []string `usage:"Permute NESTED_MODULE axis values: none, inside, parent, replaced"`
+	ModDirective []string `usage:"Permute MOD_DIRECTIVE axis values: none, replace_relative, replace_absolute, replace_version, exclude, retract"`
+	MajorVersion []string `usage:"Permute MAJOR_VERSION axis values: none, subdir, branch, dep"`
+	Gosum        []string `usage:"Permute GOSUM axis values: absent, complete, missing_entry, wrong_hash"`
+
+	MalformedGomod []string `usage:"Permute MALFORMED_GOMOD axis values: none, syntax, no_module, unknown_directive, duplicate_require, invalid_go"`
+
+	Platform []string `usage:"Permute PLATFORM axis values: host, linux_amd64, windows_amd64, darwin_arm64"`
+	Cgo      []string `usage:"Permute CGO axis values: inherit, enabled, disabled"`
+
+	ReadOnly []string `usage:"Permute READ_ONLY axis values: none, wd, module_root, gopath, modcache"`
+	Tty      []string `usage:"Permute TTY axis values: pipe, pty"`
+	Pattern  []string `usage:"Permute PATTERN axis values, which replace {pattern} in the subject arguments: dot, dot_recursive, import_path, abs_dir, rel_dir"`
+
 	// example holds command usage examples.
 	example []string
 
@@ -113,6 +160,42 @@ func (h *Handler) BindFlags(cmd *cobra.Command) []string {
 	cmd.Flags().UintVarP(&h.Timeout, "timeout", "t", 30, cage_reflect.GetFieldTag(*h, "Timeout", "usage"))
 	cmd.Flags().BoolVarP(&h.Verbose, "verbose", "v", false, cage_reflect.GetFieldTag(*h, "Verbose", "usage"))
 	cmd.Flags().BoolVarP(&h.Stdout, "stdout", "o", false, cage_reflect.GetFieldTag(*h, "Stdout", "usage"))
+	cmd.Flags().StringVarP(&h.ImportPath, "import-path", "", gomodfuzz.DefaultImportPath, cage_reflect.GetFieldTag(*h, "ImportPath", "usage"))
+	cmd.Flags().StringSliceVarP(&h.Layout, "layout", "", []string{}, cage_reflect.GetFieldTag(*h, "Layout", "usage"))
+	cmd.Flags().StringSliceVarP(&h.Goenv, "goenv", "", []string{}, cage_reflect.GetFieldTag(*h, "Goenv", "usage"))
+	cmd.Flags().StringArrayVarP(&h.GoenvSet, "goenv-set", "", []string{}, cage_reflect.GetFieldTag(*h, "GoenvSet", "usage"))
+	cmd.Flags().StringVarP(&h.FixtureModules, "fixture-modules", "", "", cage_reflect.GetFieldTag(*h, "FixtureModules", "usage"))
+	cmd.Flags().StringSliceVarP(&h.Modcache, "modcache", "", []string{}, cage_reflect.GetFieldTag(*h, "Modcache", "usage"))
+	cmd.Flags().BoolVarP(&h.SharedGocache, "shared-gocache", "", false, cage_reflect.GetFieldTag(*h, "SharedGocache", "usage"))
+	cmd.Flags().StringSliceVarP(&h.Goproxy, "goproxy", "", []string{}, cage_reflect.GetFieldTag(*h, "Goproxy", "usage"))
+	cmd.Flags().StringSliceVarP(&h.Private, "private", "", []string{}, cage_reflect.GetFieldTag(*h, "Private", "usage"))
+	cmd.Flags().StringSliceVarP(&h.ProxyFault, "proxy-fault", "", []string{}, cage_reflect.GetFieldTag(*h, "ProxyFault", "usage"))
+	cmd.Flags().BoolVarP(&h.Hermetic, "hermetic", "", false, cage_reflect.GetFieldTag(*h, "Hermetic", "usage"))
+	cmd.Flags().StringSliceVarP(&h.PassEnv, "pass-env", "", []string{}, cage_reflect.GetFieldTag(*h, "PassEnv", "usage"))
+	cmd.Flags().StringArrayVarP(&h.Env, "env", "", []string{}, cage_reflect.GetFieldTag(*h, "Env", "usage"))
+	cmd.Flags().IntVarP(&h.DdminId, "ddmin-id", "", -1, cage_reflect.GetFieldTag(*h, "DdminId", "usage"))
+	cmd.Flags().BoolVarP(&h.UnsetEnv, "unset-env", "", false, cage_reflect.GetFieldTag(*h, "UnsetEnv", "usage"))
+	cmd.Flags().BoolVarP(&h.InvalidEnv, "invalid-env", "", false, cage_reflect.GetFieldTag(*h, "InvalidEnv", "usage"))
+	cmd.Flags().BoolVarP(&h.TemplateArgs, "template-args", "", false, cage_reflect.GetFieldTag(*h, "TemplateArgs", "usage"))
+	cmd.Flags().BoolVarP(&h.TemplateEnv, "template-env", "", false, cage_reflect.GetFieldTag(*h, "TemplateEnv", "usage"))
+	cmd.Flags().StringArrayVarP(&h.Goflag, "goflag", "", []string{}, cage_reflect.GetFieldTag(*h, "Goflag", "usage"))
+	cmd.Flags().StringVarP(&h.GoflagsCompose, "goflags-compose", "", "powerset", cage_reflect.GetFieldTag(*h, "GoflagsCompose", "usage"))
+	cmd.Flags().StringSliceVarP(&h.Vcs, "vcs", "", []string{}, cage_reflect.GetFieldTag(*h, "Vcs", "usage"))
+	cmd.Flags().BoolVarP(&h.BuildvcsFalse, "buildvcs-false", "", false, cage_reflect.GetFieldTag(*h, "BuildvcsFalse", "usage"))
+	cmd.Flags().StringSliceVarP(&h.GoDirective, "go-directive", "", []string{}, cage_reflect.GetFieldTag(*h, "GoDirective", "usage"))
+	cmd.Flags().StringSliceVarP(&h.Toolchain, "toolchain", "", []string{}, cage_reflect.GetFieldTag(*h, "Toolchain", "usage"))
+	cmd.Flags().StringSliceVarP(&h.PathShape, "path-shape", "", []string{}, cage_reflect.GetFieldTag(*h, "PathShape", "usage"))
+	cmd.Flags().StringSliceVarP(&h.SpecialDir, "special-dir", "", []string{}, cage_reflect.GetFieldTag(*h, "SpecialDir", "usage"))
+	cmd.Flags().StringSliceVarP(&h.NestedModule, "nested-module", "", []string{}, cage_reflect.GetFieldTag(*h, "NestedModule", "usage"))
+	cmd.Flags().StringSliceVarP(&h.ModDirective, "mod-directive", "", []string{}, cage_reflect.GetFieldTag(*h, "ModDirective", "usage"))
+	cmd.Flags().StringSliceVarP(&h.MajorVersion, "major-version", "", []string{}, cage_reflect.GetFieldTag(*h, "MajorVersion", "usage"))
+	cmd.Flags().StringSliceVarP(&h.Gosum, "gosum", "", []string{}, cage_reflect.GetFieldTag(*h, "Gosum", "usage"))
+	cmd.Flags().StringSliceVarP(&h.MalformedGomod, "malformed-gomod", "", []string{}, cage_reflect.GetFieldTag(*h, "MalformedGomod", "usage"))
+	cmd.Flags().StringSliceVarP(&h.Platform, "platform", "", []string{}, cage_reflect.GetFieldTag(*h, "Platform", "usage"))
+	cmd.Flags().StringSliceVarP(&h.Cgo, "cgo", "", []string{}, cage_reflect.GetFieldTag(*h, "Cgo", "usage"))
+	cmd.Flags().StringSliceVarP(&h.ReadOnly, "read-only", "", []string{}, cage_reflect.GetFieldTag(*h, "ReadOnly", "usage"))
+	cmd.Flags().StringSliceVarP(&h.Tty, "tty", "", []string{}, cage_reflect.GetFieldTag(*h, "Tty", "usage"))
+	cmd.Flags().StringSliceVarP(&h.Pattern, "pattern", "", []string{}, cage_reflect.GetFieldTag(*h, "Pattern", "usage"))
 	return []string{}
 }
 
@@ -124,16 +207,255 @@ func (h *Handler) Run(ctx context.Context, input handler.Input) {
 		h.log.Exitf(1, "command not specified (example: %s)", h.example[0])
 	}
 
+	config := gomodfuzz.Config{
+		BuildvcsFalse:  h.BuildvcsFalse,
+		GoenvSettings:  h.GoenvSet,
+		Goflags:        h.Goflag,
+		Hermetic:       h.Hermetic,
+		PassEnv:        h.PassEnv,
+		UnsetEnvAxes:   h.UnsetEnv,
+		InvalidEnvAxes: h.InvalidEnv,
+		ImportPath:     h.ImportPath,
+		SharedGocache:  h.SharedGocache,
+		Env:            h.Env,
+		TemplateArgs:   h.TemplateArgs,
+		TemplateEnv:    h.TemplateEnv,
+	}
+
+	var err error
+
+	if h.InvalidEnv {
+		executor := cage_exec.CommonExecutor{}
+		stdout, _, _, gorootErr := executor.Buffered(ctx, executor.Command("go", "env", "GOROOT"))
+		if gorootErr != nil {
+			h.log.ExitOnErr(1, errors.Wrap(gorootErr, "failed to get GOROOT for --invalid-env"))
+		}
+		config.Goroot = strings.TrimSpace(stdout.String())
+	}
+
+	if h.FixtureModules != "" {
+		if config.FixtureModules, err = gomodfuzz.LoadFixtureModules(h.FixtureModules); err != nil {
+			h.log.ExitOnErr(1, err)
+		}
+	}
+
+	if config.Layouts, err = gomodfuzz.ParseModes("LAYOUT", h.Layout); err != nil {
+		h.log.ExitOnErr(1, err)
+	}
+
+	for _, setting := range h.GoenvSet {
+		if !strings.Contains(setting, "=") {
+			h.log.Exitf(1, "--goenv-set value [%s] is not in KEY=VALUE format", setting)
+		}
+	}
+	for _, pair := range h.Env {
+		if !strings.Contains(pair, "=") {
+			h.log.Exitf(1, "--env value [%s] is not in KEY=VALUE format", pair)
+		}
+	}
+	if len(h.Goenv) == 0 && len(h.GoenvSet) > 0 {
+		h.Goenv = gomodfuzz.ModeNames("GOENV")
+	}
+	if config.Goenvs, err = gomodfuzz.ParseModes("GOENV", h.Goenv); err != nil {
+		h.log.ExitOnErr(1, err)
+	}
+	for _, mode := range config.Goenvs {
+		if mode == gomodfuzz.WrittenGoenv && len(h.GoenvSet) == 0 {
+			h.log.Exitf(1, "GOENV axis value [%s] requires at least one --goenv-set", gomodfuzz.ModeName("GOENV", mode))
+		}
+	}
+
+	if config.Modcaches, err = gomodfuzz.ParseModes("MODCACHE", h.Modcache); err != nil {
+		h.log.ExitOnErr(1, err)
+	}
+	for _, mode := range config.Modcaches {
+		if mode != gomodfuzz.EmptyModcache && len(config.FixtureModules) == 0 {
+			h.log.Exitf(1, "MODCACHE axis value [%s] requires --fixture-modules", gomodfuzz.ModeName("MODCACHE", mode))
+		}
+	}
+
+	if config.ProxyFaults, err = gomodfuzz.ParseModes("PROXY_FAULT", h.ProxyFault); err != nil {
+		h.log.ExitOnErr(1, err)
+	}
+	if len(h.Goproxy) == 0 && len(h.ProxyFault) > 0 {
+		h.Goproxy = []string{gomodfuzz.ModeName("GOPROXY", gomodfuzz.HTTPGoproxy)}
+	}
+	if config.Goproxies, err = gomodfuzz.ParseModes("GOPROXY", h.Goproxy); err != nil {
+		h.log.ExitOnErr(1, err)
+	}
+
+	var useProxyServer bool
+	for _, mode := range config.Goproxies {
+		if mode == gomodfuzz.HTTPGoproxy {
+			useProxyServer = true
+		}
+	}
+	if !useProxyServer {
+		for _, mode := range config.ProxyFaults {
+			if mode != gomodfuzz.NoProxyFault {
+				h.log.Exitf(1, "PROXY_FAULT axis value [%s] requires GOPROXY axis value [http]", gomodfuzz.ModeName("PROXY_FAULT", mode))
+			}
+		}
+	}
+	if config.Privates, err = gomodfuzz.ParseModes("PRIVATE", h.Private); err != nil {
+		h.log.ExitOnErr(1, err)
+	}
+	if len(config.FixtureModules) == 0 {
+		for _, mode := range config.Goproxies {
+			if mode == gomodfuzz.FileGoproxy || mode == gomodfuzz.HTTPGoproxy {
+				h.log.Exitf(1, "GOPROXY axis value [%s] requires --fixture-modules", gomodfuzz.ModeName("GOPROXY", mode))
+			}
+		}
+		for _, mode := range config.Privates {
+			if mode != gomodfuzz.PublicModules && mode != gomodfuzz.UnsetPrivateModules {
+				h.log.Exitf(1, "PRIVATE axis value [%s] requires --fixture-modules", gomodfuzz.ModeName("PRIVATE", mode))
+			}
+		}
+	}
+
+	if config.MalformedGomods, err = gomodfuzz.ParseModes("MALFORMED_GOMOD", h.MalformedGomod); err != nil {
+		h.log.ExitOnErr(1, err)
+	}
+	if config.Platforms, err = gomodfuzz.ParseModes("PLATFORM", h.Platform); err != nil {
+		h.log.ExitOnErr(1, err)
+	}
+	if config.Cgos, err = gomodfuzz.ParseModes("CGO", h.Cgo); err != nil {
+		h.log.ExitOnErr(1, err)
+	}
+	if config.ReadOnlys, err = gomodfuzz.ParseModes("READ_ONLY", h.ReadOnly); err != nil {
+		h.log.ExitOnErr(1, err)
+	}
+	if config.Ttys, err = gomodfuzz.ParseModes("TTY", h.Tty); err != nil {
+		h.log.ExitOnErr(1, err)
+	}
+	if config.Patterns, err = gomodfuzz.ParseModes("PATTERN", h.Pattern); err != nil {
+		h.log.ExitOnErr(1, err)
+	}
+	if len(config.Patterns) > 0 && !strings.Contains(strings.Join(input.Args, " "), gomodfuzz.PatternPlaceholder) {
+		h.log.Exitf(1, "--pattern requires a subject argument which contains %s, e.g. go list %s", gomodfuzz.PatternPlaceholder, gomodfuzz.PatternPlaceholder)
+	}
+
+	if config.Gosums, err = gomodfuzz.ParseModes("GOSUM", h.Gosum); err != nil {
+		h.log.ExitOnErr(1, err)
+	}
+	if len(config.FixtureModules) == 0 {
+		for _, mode := range config.Gosums {
+			if mode != gomodfuzz.NoGosum {
+				h.log.Exitf(1, "GOSUM axis value [%s] requires --fixture-modules", gomodfuzz.ModeName("GOSUM", mode))
+			}
+		}
+	}
+
+	for _, flag := range h.Goflag {
+		if !strings.HasPrefix(flag, "-") || len(strings.Fields(flag)) != 1 {
+			h.log.Exitf(1, "--goflag value [%s] must be a single flag, e.g. -mod=mod", flag)
+		}
+	}
+	switch h.GoflagsCompose {
+	case "powerset":
+		config.GoflagsCompose = gomodfuzz.PowerSetGoflags
+	case "pairs":
+		config.GoflagsCompose = gomodfuzz.PairGoflags
+	default:
+		h.log.Exitf(1, "invalid --goflags-compose value [%s], expected one of: powerset, pairs", h.GoflagsCompose)
+	}
+
+	if h.DdminId >= 0 && h.Hermetic {
+		h.log.Exitf(1, "--ddmin-id cannot be combined with --hermetic, which does not inherit the host variables it tests")
+	}
+
+	if config.Vcses, err = gomodfuzz.ParseModes("VCS", h.Vcs); err != nil {
+		h.log.ExitOnErr(1, err)
+	}
+
+	if config.GoDirectives, err = gomodfuzz.ParseModes("GO_DIRECTIVE", h.GoDirective); err != nil {
+		h.log.ExitOnErr(1, err)
+	}
+	if config.Toolchains, err = gomodfuzz.ParseModes("TOOLCHAIN", h.Toolchain); err != nil {
+		h.log.ExitOnErr(1, err)
+	}
+	if config.PathShapes, err = gomodfuzz.ParseModes("PATH_SHAPE", h.PathShape); err != nil {
+		h.log.ExitOnErr(1, err)
+	}
+	if config.SpecialDirs, err = gomodfuzz.ParseModes("SPECIAL_DIR", h.SpecialDir); err != nil {
+		h.log.ExitOnErr(1, err)
+	}
+	if config.NestedModules, err = gomodfuzz.ParseModes("NESTED_MODULE", h.NestedModule); err != nil {
+		h.log.ExitOnErr(1, err)
+	}
+	if config.ModDirectives, err = gomodfuzz.ParseModes("MOD_DIRECTIVE", h.ModDirective); err != nil {
+		h.log.ExitOnErr(1, err)
+	}
+	for _, mode := range config.ModDirectives {
+		if mode != gomodfuzz.ReplaceVersionModDirective && mode != gomodfuzz.ExcludeModDirective {
+			continue
+		}
+		versions := map[string]int{}
+		var found bool
+		for _, m := range config.FixtureModules {
+			versions[m.Path]++
+			found = found || versions[m.Path] > 1
+		}
+		if !found {
+			h.log.Exitf(1, "MOD_DIRECTIVE axis value [%s] requires --fixture-modules with two versions of a module", gomodfuzz.ModeName("MOD_DIRECTIVE", mode))
+		}
+	}
+	if config.MajorVersions, err = gomodfuzz.ParseModes("MAJOR_VERSION", h.MajorVersion); err != nil {
+		h.log.ExitOnErr(1, err)
+	}
+	for _, mode := range config.MajorVersions {
+		if mode != gomodfuzz.DepMajorVersion {
+			continue
+		}
+		var found bool
+		for _, m := range config.FixtureModules {
+			found = found || gomodfuzz.HasMajorSuffix(m.Path)
+		}
+		if !found {
+			h.log.Exitf(1, "MAJOR_VERSION axis value [%s] requires --fixture-modules with a /vN module, e.g. example.com/dep/v2", gomodfuzz.ModeName("MAJOR_VERSION", mode))
+		}
+	}
+
 	// Generate all scenario permutations and run them serially.
 
 	var results []gomodfuzz.Result
 
-	baseScenario := gomodfuzz.NewScenario(cage_exec.CommonExecutor{}, h.stage.Path())
+	baseScenario := gomodfuzz.NewScenario(cage_exec.CommonExecutor{}, h.stage.Path(), config)
+
+	if len(config.FixtureModules) > 0 {
+		if err = gomodfuzz.WriteProxyTree(config.FixtureModules, baseScenario.FileProxyDir()); err != nil {
+			h.log.ExitOnErr(1, errors.Wrap(err, "failed to create file:// GOPROXY"))
+		}
+	}
 
-	for _, permutation := range tp_algo.Permute(&baseScenario) {
-		s := permutation.(gomodfuzz.Scenario) //nolint:errcheck
+	// closeProxyServer is a no-op unless the GOPROXY server is started. It must be called before exiting.
+	closeProxyServer := func() {}
 
+	if useProxyServer {
+		// Delay "slow" responses beyond the subject's timeout.
+		proxyServer := gomodfuzz.NewProxyServer(baseScenario.FileProxyDir(), 2*time.Duration(h.Timeout)*time.Second)
+		if err = proxyServer.Start(); err != nil {
+			h.log.ExitOnErr(1, err)
+		}
+		closeProxyServer = func() {
+			h.log.ExitOnErr(1, proxyServer.Close())
+		}
+
+		config.ProxyURL = proxyServer.URL()
+		baseScenario = gomodfuzz.NewScenario(cage_exec.CommonExecutor{}, h.stage.Path(), config)
+	}
+
+	if h.DdminId >= 0 {
+		ddminErr := h.debugHostEnv(ctx, baseScenario, input.Args)
+		closeProxyServer()
+		h.log.ExitOnErr(1, ddminErr)
+		h.log.ExitOnErr(1, cage_file.RemoveAllSafer(h.stage.Path()))
+		return
+	}
+
+	for _, s := range gomodfuzz.Permute(&baseScenario) {
 		if err := s.BeforeRun(h.stage); err != nil {
+			closeProxyServer()
 			h.log.ExitOnErr(1, errors.Wrapf(err, "failed to run prepare environment for scenario [%s]", s))
 		}
 
@@ -142,12 +464,15 @@ func (h *Handler) Run(ctx context.Context, input handler.Input) {
 
 		r, err := s.Run(cmdCtx, input.Args)
 		if err != nil {
+			closeProxyServer()
 			h.log.ExitOnErr(1, errors.Wrapf(err, "failed to run scenario [%s]", s))
 		}
 
 		results = append(results, r)
 	}
 
+	closeProxyServer()
+
 	// Display scenario results.
 
 	hr := func(n int) {
@@ -156,51 +481,48 @@ func (h *Handler) Run(ctx context.Context, input handler.Input) {
 		}
 	}
 
-	// passCauses indexes occurrence counts first by variable name (e.g. "GO111MODULE") then by variable value.
-	// It supports the pass-cause summary.
-	passCauses := map[string]map[string]int{
-		"GO111MODULE": {},
-		"GOFLAGS":     {},
-		"GOPATH":      {},
-		"IN_MODULE":   {},
-		"WD":          {},
+	// printReport displays the SubjectReport, if any, which the subject wrote to its result file.
+	printReport := func(r gomodfuzz.Result) {
+		if r.Report == nil {
+			return
+		}
+		if r.Report.Pass != nil {
+			fmt.Fprintf(h.Out(), "\tReported pass: %t\n", *r.Report.Pass)
+		}
+		for _, c := range r.Report.Checks {
+			verdict := "pass"
+			if !c.Pass {
+				verdict = "fail"
+			}
+			if c.Message == "" {
+				fmt.Fprintf(h.Out(), "\tCheck %s: %s\n", c.Name, verdict)
+			} else {
+				fmt.Fprintf(h.Out(), "\tCheck %s: %s: %s\n", c.Name, verdict, c.Message)
+			}
+		}
+		for _, name := range r.Report.MetricNames() {
+			fmt.Fprintf(h.Out(), "\tMetric %s: %v\n", name, r.Report.Metrics[name])
+		}
 	}
 
-	// failCauses indexes occurrence counts first by variable name (e.g. "GO111MODULE") then by variable value.
-	// It supports the failure-cause summary.
-	failCauses := map[string]map[string]int{
-		"GO111MODULE": {},
-		"GOFLAGS":     {},
-		"GOPATH":      {},
-		"IN_MODULE":   {},
-		"WD":          {},
+	// newCauses returns an index of occurrence counts first by axis name (e.g. "GO111MODULE") then by value label.
+	newCauses := func() map[string]map[string]int {
+		causes := map[string]map[string]int{}
+		for _, axis := range baseScenario.PermuteAxes() {
+			causes[axis.(string)] = map[string]int{}
+		}
+		return causes
 	}
 
+	// passCauses supports the pass-cause summary.
+	passCauses := newCauses()
+
+	// failCauses supports the failure-cause summary.
+	failCauses := newCauses()
+
 	updateCauses := func(current map[string]map[string]int, s gomodfuzz.Scenario) {
-		current["GO111MODULE"][s.GO111MODULE]++
-		if s.GOFLAGS == "" {
-			current["GOFLAGS"]["<empty>"]++
-		} else {
-			current["GOFLAGS"][s.GOFLAGS]++
-		}
-		switch s.GOPATH {
-		case gomodfuzz.EmptyGopath:
-			current["GOPATH"]["<empty>"]++
-		case gomodfuzz.UsableGopath:
-			current["GOPATH"]["a file tree that may contain WD"]++
-		case gomodfuzz.UnusedGopath:
-			current["GOPATH"]["a file that never contains WD"]++
-		}
-		if s.IN_MODULE {
-			current["IN_MODULE"]["inside a module"]++
-		} else {
-			current["IN_MODULE"]["outside a module"]++
-		}
-		switch s.WD {
-		case gomodfuzz.WdInsideGopath:
-			current["WD"]["inside the GOPATH"]++
-		case gomodfuzz.WdOutsideGopath:
-			current["WD"]["outside the GOPATH"]++
+		for axis, label := range s.AxisLabels() {
+			current[axis][label]++
 		}
 	}
 
@@ -215,11 +537,31 @@ func (h *Handler) Run(ctx context.Context, input handler.Input) {
 	}
 
 	var passes int
+	var readOnlyWriters []string
+	outcomes := map[int]int{}
+	failedChecks := map[string]int{}
 	for n, r := range results {
-		if r.Code == 0 && r.Err == nil {
+		outcomes[r.Outcome]++
+		if r.Report != nil {
+			for _, c := range r.Report.FailedChecks() {
+				failedChecks[c.Name]++
+			}
+		}
+		if len(r.ReadOnlyWrites) > 0 {
+			readOnlyWriters = append(readOnlyWriters, strconv.Itoa(r.Scenario.Id()))
+		}
+
+		if r.Outcome == gomodfuzz.PassOutcome {
 			if h.Verbose {
 				hr(n)
-				fmt.Fprintf(h.Out(), "PASS: %s\n", r.Scenario.String())
+				fmt.Fprintf(h.Out(), "PASS (id %d): %s\n", r.Scenario.Id(), r.Scenario.String())
+				if len(config.SpecialDirs) > 0 {
+					fmt.Fprintf(h.Out(), "\tGOMOD: %s\n", r.GoMod)
+				}
+				if len(r.ReadOnlyWrites) > 0 {
+					fmt.Fprintf(h.Out(), "\tRead-only writes: %s\n", strings.Join(r.ReadOnlyWrites, ", "))
+				}
+				printReport(r)
 			}
 
 			updateCauses(passCauses, r.Scenario)
@@ -230,13 +572,34 @@ func (h *Handler) Run(ctx context.Context, input handler.Input) {
 
 			updateCauses(failCauses, r.Scenario)
 
-			fmt.Fprintf(h.Out(), "FAIL (exit code %d): %s\n", r.Code, r.Scenario.String())
-			if r.Err != nil && h.Verbose {
-				fmt.Fprintf(h.Out(), "\tErr: %+v\n", r.Err)
+			fmt.Fprintf(h.Out(), "FAIL (exit code %d, id %d): %s\n", r.Code, r.Scenario.Id(), r.Scenario.String())
+			fmt.Fprintf(h.Out(), "\tOutcome: %s\n", gomodfuzz.OutcomeName(r.Outcome))
+			if len(config.SpecialDirs) > 0 {
+				// Whether the go command found the module from the special directory often explains the result.
+				fmt.Fprintf(h.Out(), "\tGOMOD: %s\n", r.GoMod)
 			}
-			fmt.Fprintf(h.Out(), "\tStderr (len=%d): %+v\n", len(r.Stderr), r.Stderr)
-			if h.Stdout {
-				fmt.Fprintf(h.Out(), "\tStdout (len=%d): %+v\n", len(r.Stdout), r.Stdout)
+			if len(r.ReadOnlyWrites) > 0 {
+				fmt.Fprintf(h.Out(), "\tRead-only writes: %s\n", strings.Join(r.ReadOnlyWrites, ", "))
+			}
+			if len(config.Patterns) > 0 {
+				fmt.Fprintf(h.Out(), "\tPattern: %s\n", r.Scenario.Pattern())
+			}
+			if r.Err != nil {
+				if h.Verbose {
+					fmt.Fprintf(h.Out(), "\tErr: %+v\n", r.Err)
+				} else if r.Code == -1 || r.Code == 0 { // the command did not run, or its result file is invalid
+					fmt.Fprintf(h.Out(), "\tErr: %v\n", r.Err)
+				}
+			}
+			printReport(r)
+			if r.Scenario.TTY == gomodfuzz.PtyTty {
+				// Standard out and error are not separable in the terminal.
+				fmt.Fprintf(h.Out(), "\tTranscript (len=%d): %+v\n", len(r.Transcript), r.Transcript)
+			} else {
+				fmt.Fprintf(h.Out(), "\tStderr (len=%d): %+v\n", len(r.Stderr), r.Stderr)
+				if h.Stdout {
+					fmt.Fprintf(h.Out(), "\tStdout (len=%d): %+v\n", len(r.Stdout), r.Stdout)
+				}
 			}
 			if h.Verbose {
 				fmt.Fprintf(h.Out(), "\tgo env: %+v\n", strings.TrimSpace(r.GoEnv))
@@ -246,6 +609,42 @@ func (h *Handler) Run(ctx context.Context, input handler.Input) {
 
 	fmt.Fprintf(h.Out(), "\n- %d/%d scenarios passed\n", passes, len(results))
 
+	if len(results) != passes {
+		var counts []string
+		for outcome, name := range gomodfuzz.OutcomeNames() {
+			if outcome != gomodfuzz.PassOutcome {
+				counts = append(counts, fmt.Sprintf("%s: %d", name, outcomes[outcome]))
+			}
+		}
+		fmt.Fprintf(h.Out(), "- Failure outcomes: %s\n", strings.Join(counts, ", "))
+	}
+
+	if len(failedChecks) > 0 {
+		var names []string
+		for name := range failedChecks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		var counts []string
+		for _, name := range names {
+			counts = append(counts, fmt.Sprintf("%s: %d", name, failedChecks[name]))
+		}
+		fmt.Fprintf(h.Out(), "- Failed checks: %s\n", strings.Join(counts, ", "))
+	}
+
+	if len(readOnlyWriters) > 0 {
+		// Writes to read-only directories only succeed if permissions are not enforced, e.g. as root,
+		// so report them even if the scenario passed.
+		fmt.Fprintf(h.Out(), "- Scenarios which wrote to read-only directories: %d (ids %s)\n",
+			len(readOnlyWriters), strings.Join(readOnlyWriters, ", "))
+	}
+
+	if h.Hermetic && len(results) > 0 {
+		// All scenarios inherit the same host variables.
+		dropped := results[0].DroppedEnv
+		fmt.Fprintf(h.Out(), "- Hermetic environment dropped %d host variables: %s\n", len(dropped), strings.Join(dropped, ", "))
+	}
+
 	if h.Verbose && passes > 0 {
 		printCauses("- Occurrences in passes:", passCauses, passes)
 	}
@@ -261,4 +660,69 @@ func (h *Handler) Run(ctx context.Context, input handler.Input) {
 	}
 }
 
+// debugHostEnv runs the scenario selected by --ddmin-id with subsets of the host environment and displays
+// which inherited variables cause it to fail.
+func (h *Handler) debugHostEnv(ctx context.Context, baseScenario gomodfuzz.Scenario, args []string) error {
+	var scenario gomodfuzz.Scenario
+	var found bool
+	for _, s := range gomodfuzz.Permute(&baseScenario) {
+		if s.Id() == h.DdminId {
+			scenario, found = s, true
+			break
+		}
+	}
+	if !found {
+		return errors.Errorf("scenario with --ddmin-id [%d] not found", h.DdminId)
+	}
+
+	var runs int
+
+	// fails runs the scenario in a new file tree and returns true if it fails.
+	fails := func(host []string) (bool, error) {
+		s := scenario.WithHostEnv(host)
+
+		if err := cage_file.RemoveAllSafer(s.ScenarioDir()); err != nil {
+			return false, errors.Wrapf(err, "failed to remove scenario [%s] file tree", s)
+		}
+		if err := s.BeforeRun(h.stage); err != nil {
+			return false, errors.Wrapf(err, "failed to run prepare environment for scenario [%s]", s)
+		}
+
+		cmdCtx, cmdCancel := context.WithTimeout(ctx, time.Duration(h.Timeout)*time.Second)
+		defer cmdCancel()
+
+		r, err := s.Run(cmdCtx, args)
+		if err != nil {
+			return false, errors.Wrapf(err, "failed to run scenario [%s]", s)
+		}
+
+		runs++
+		if h.Verbose {
+			fmt.Fprintf(h.Out(), "- Run %d with %d host variables: exit code %d\n", runs, len(host), r.Code)
+		}
+
+		return r.Outcome != gomodfuzz.PassOutcome, nil
+	}
+
+	causes, err := gomodfuzz.DebugHostEnv(os.Environ(), fails)
+	if err != nil {
+		return errors.Wrapf(err, "failed to debug host environment of scenario [%s]", scenario)
+	}
+
+	fmt.Fprintf(h.Out(), "Scenario (id %d): %s\n", scenario.Id(), scenario)
+	fmt.Fprintf(h.Out(), "- Tested %d host variables in %d runs\n", len(causes.Candidates), runs)
+	if len(causes.Required) == 0 {
+		fmt.Fprintln(h.Out(), "- The failure does not require any host variables (PATH, HOME, and TMPDIR are always inherited)")
+	} else {
+		fmt.Fprintf(h.Out(), "- Minimal host variables which reproduce the failure: %s\n", strings.Join(causes.Required, ", "))
+	}
+	if causes.RemovalFound {
+		fmt.Fprintf(h.Out(), "- Minimal host variables whose removal makes it pass: %s\n", strings.Join(causes.Removal, ", "))
+	} else {
+		fmt.Fprintln(h.Out(), "- No removal of host variables makes it pass")
+	}
+
+	return nil
+}
+
 var _ handler_cobra.Handler = (*Handler)(nil)
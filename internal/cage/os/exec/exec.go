@@ -21,6 +21,7 @@ import (
 	"time"
 
 	tp_exec "github.com/codeactual/gomodfuzz/internal/third_party/github.com/os/exec"
+	"github.com/kr/pty"
 	"github.com/pkg/errors"
 	"golang.org/x/sync/errgroup"
 
@@ -30,6 +31,10 @@ import (
 const (
 	SigIntDelay  = 2 * time.Second
 	SigKillDelay = 5 * time.Second
+
+	// PtyRows and PtyCols are the size of the pseudo-terminal created by PtyBuffered.
+	PtyRows = 24
+	PtyCols = 80
 )
 
 type Result struct {
@@ -116,6 +121,15 @@ type Executor interface {
 
 	// Pty runs the command in a pseudo-terminal and returns an error only if the command fails to start.
 	Pty(cmd *std_exec.Cmd) error
+
+	// PtyBuffered runs the command in a pseudo-terminal and returns its transcript in addition to the exit code.
+	//
+	// - Unlike Pty, the terminal is not connected to the standard in/out of the current process.
+	// - The transcript holds everything the command wrote to the terminal, including standard error,
+	//   with line endings translated by the terminal, e.g. "\r\n".
+	// - Return error should be used to determine success. The returned Result holds the exit code
+	//   and process IDs but not standard out/error.
+	PtyBuffered(ctx context.Context, cmd *std_exec.Cmd) (transcript *bytes.Buffer, res Result, err error)
 }
 
 // CommonExecutor provides a general case Executor implementation.
@@ -391,6 +405,113 @@ func (c CommonExecutor) Pty(cmd *std_exec.Cmd) error {
 	return tp_exec.Pty(cmd)
 }
 
+// PtyBuffered runs the command in a pseudo-terminal and returns its transcript in addition to the exit code.
+//
+// It implements an Executor behavior.
+//
+// It is separate from Pty because Pty is an interactive session: it puts the current process's standard in
+// into raw mode, follows its terminal size, and copies to its standard out, but takes no context and reports
+// no exit code. Changing those behaviors would break Pty's existing callers.
+func (c CommonExecutor) PtyBuffered(ctx context.Context, cmd *std_exec.Cmd) (transcript *bytes.Buffer, res Result, err error) {
+	transcript = new(bytes.Buffer)
+
+	// for all error cases that happen before Wait
+	res.Code = -1
+	res.Pid = -1
+	res.Pgid = -1
+
+	if ctx == nil {
+		return transcript, res, errors.New("non-nil context is required")
+	}
+	if cmd == nil {
+		return transcript, res, errors.New("command is nil")
+	}
+
+	ptmx, tty, openErr := pty.Open()
+	if openErr != nil {
+		return transcript, res, errors.Wrap(openErr, "failed to open pseudo-terminal")
+	}
+	defer func() { _ = ptmx.Close() }() // Best effort.
+
+	// Use a fixed size so output does not depend on the terminal, if any, of the current process.
+	if sizeErr := pty.Setsize(tty, &pty.Winsize{Rows: PtyRows, Cols: PtyCols}); sizeErr != nil {
+		_ = tty.Close()
+		return transcript, res, errors.Wrap(sizeErr, "failed to set pseudo-terminal size")
+	}
+
+	cmd.Stdin = tty
+	cmd.Stdout = tty
+	cmd.Stderr = tty
+
+	// The new session's process group, led by the command, can be killed as a whole like in Standard.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true}
+
+	startErr := cmd.Start()
+	_ = tty.Close() // The command holds its own copy.
+	if startErr != nil {
+		res.Err = startErr
+		return transcript, res, errors.Wrapf(startErr, "failed to start command: %s", CmdToString(cmd))
+	}
+
+	res.Pid = cmd.Process.Pid
+	res.Pgid = res.Pid
+
+	// Reads fail, e.g. with EIO on Linux, once all processes have closed the terminal.
+	copyDone := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(transcript, ptmx)
+		close(copyDone)
+	}()
+
+	waitDone := make(chan struct{})
+	go func(pgid int) {
+		select {
+		case <-waitDone:
+			return
+		case <-ctx.Done():
+		}
+
+		// Recheck waitDone before each signal so a process group ID reused after the command exited is not signaled.
+		select {
+		case <-waitDone:
+			return
+		case <-time.After(SigIntDelay):
+		}
+		if err := syscall.Kill(pgid, syscall.SIGINT); err != nil && err.Error() != "no such process" {
+			fmt.Fprintf(os.Stderr, "failed to SIGINT process group %d: %+v\n", pgid, errors.WithStack(err))
+		}
+		select {
+		case <-waitDone:
+			return
+		case <-time.After(SigKillDelay - SigIntDelay):
+		}
+		if err := syscall.Kill(pgid, syscall.SIGKILL); err != nil && err.Error() != "no such process" {
+			fmt.Fprintf(os.Stderr, "failed to SIGKILL process group %d: %+v\n", pgid, errors.WithStack(err))
+		}
+	}(-res.Pgid) // syscall.Kill requires a negative value to denote a process group
+
+	waitErr := cmd.Wait()
+	close(waitDone)
+	<-copyDone
+
+	if waitErr == nil {
+		res.Code = 0
+		return transcript, res, nil
+	}
+
+	res.Err = waitErr
+	res.Code = 1
+
+	// Try to get a more specific exit code (e.g. on Linux where its supported).
+	if exitErr, ok := waitErr.(*std_exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			res.Code = status.ExitStatus()
+		}
+	}
+
+	return transcript, res, errors.Wrapf(waitErr, "command failed: %s", CmdToString(cmd))
+}
+
 var _ Executor = (*CommonExecutor)(nil)
 
 // CmdToString stringifies an os/exec.Cmd.
@@ -1150,3 +1150,50 @@ func TestArgToCmd(t *testing.T) {
 		}
 	})
 }
+
+func TestPtyBuffered(t *testing.T) {
+	t.Run("should fail if no context specified", func(t *testing.T) {
+		//lint:ignore SA1012 nil context is the SUT
+		transcript, res, err := cage_exec.CommonExecutor{}.PtyBuffered(nil, exec.Command("/bin/sh", "-c", "true"))
+		require.Exactly(t, "", transcript.String())
+		require.Exactly(t, -1, res.Code)
+		require.EqualError(t, err, "non-nil context is required")
+	})
+
+	t.Run("should capture transcript", func(t *testing.T) {
+		cmd := exec.Command("/bin/sh", "-c", `test -t 0 && test -t 1 && test -t 2 && stty size && echo out && echo err >&2`)
+		transcript, res, err := cage_exec.CommonExecutor{}.PtyBuffered(context.Background(), cmd)
+		require.NoError(t, err)
+		require.Exactly(t, 0, res.Code)
+		require.NotZero(t, res.Pid)
+		require.Exactly(t, fmt.Sprintf("%d %d\r\nout\r\nerr\r\n", cage_exec.PtyRows, cage_exec.PtyCols), transcript.String())
+	})
+
+	t.Run("should handle exit code", func(t *testing.T) {
+		cmd := exec.Command("/bin/sh", "-c", "echo out && exit 3")
+		transcript, res, err := cage_exec.CommonExecutor{}.PtyBuffered(context.Background(), cmd)
+		require.EqualError(t, err, `command failed: path=/bin/sh args=[]string{"-c", "echo out && exit 3"} dir=: exit status 3`)
+		require.Exactly(t, 3, res.Code)
+		require.Exactly(t, "out\r\n", transcript.String())
+	})
+
+	t.Run("should kill command via context timeout", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		cmd := exec.Command("/bin/sh", "-c", "echo out && sleep 10")
+		transcript, res, err := cage_exec.CommonExecutor{}.PtyBuffered(ctx, cmd)
+		require.EqualError(t, err, `command failed: path=/bin/sh args=[]string{"-c", "echo out && sleep 10"} dir=: signal: interrupt`)
+		require.Exactly(t, -1, res.Code)
+		require.Exactly(t, "out\r\n", transcript.String())
+	})
+
+	t.Run("should not wait for background processes", func(t *testing.T) {
+		cmd := exec.Command("/bin/sh", "-c", "sleep 5 & echo out")
+		start := time.Now()
+		transcript, res, err := cage_exec.CommonExecutor{}.PtyBuffered(context.Background(), cmd)
+		require.NoError(t, err)
+		require.Exactly(t, 0, res.Code)
+		require.Exactly(t, "out\r\n", transcript.String())
+		require.True(t, time.Since(start) < 4*time.Second)
+	})
+}
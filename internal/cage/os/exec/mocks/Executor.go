@@ -120,6 +120,36 @@ func (_m *Executor) Pty(cmd *exec.Cmd) error {
 	return r0
 }
 
+// PtyBuffered provides a mock function with given fields: ctx, cmd
+func (_m *Executor) PtyBuffered(ctx context.Context, cmd *exec.Cmd) (*bytes.Buffer, osexec.Result, error) {
+	ret := _m.Called(ctx, cmd)
+
+	var r0 *bytes.Buffer
+	if rf, ok := ret.Get(0).(func(context.Context, *exec.Cmd) *bytes.Buffer); ok {
+		r0 = rf(ctx, cmd)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*bytes.Buffer)
+		}
+	}
+
+	var r1 osexec.Result
+	if rf, ok := ret.Get(1).(func(context.Context, *exec.Cmd) osexec.Result); ok {
+		r1 = rf(ctx, cmd)
+	} else {
+		r1 = ret.Get(1).(osexec.Result)
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, *exec.Cmd) error); ok {
+		r2 = rf(ctx, cmd)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
 // Standard provides a mock function with given fields: ctx, stdout, stderr, stdin, cmds
 func (_m *Executor) Standard(ctx context.Context, stdout io.Writer, stderr io.Writer, stdin io.Reader, cmds ...*exec.Cmd) (osexec.PipelineResult, error) {
 	_va := make([]interface{}, len(cmds))
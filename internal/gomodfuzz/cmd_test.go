@@ -9,6 +9,7 @@ package gomodfuzz_test
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"os/exec"
 	"path/filepath"
 	"testing"
@@ -44,7 +45,7 @@ func (s *CmdSuite) TestScenarioApplied() {
 	t := s.T()
 
 	ctx := context.Background()
-	ctxType := mock.AnythingOfType("*context.emptyCtx") // context.Background()
+	ctxType := mock.AnythingOfType(fmt.Sprintf("%T", ctx)) // context.Background(), whose type varies by Go version
 	expectRootDir := filepath.Join(testkit_file.DynamicDataDir(), "scenario_applied")
 	stage := cage_file_stage.NewStage(expectRootDir)
 	stagePath := testkit_filepath.Abs(t, stage.Path())
@@ -62,6 +63,9 @@ func (s *CmdSuite) TestScenarioApplied() {
 			require.Contains(t, mockCmd.(*exec.Cmd).Env, "GO111MODULE="+scenario.GO111MODULE)
 			require.Contains(t, mockCmd.(*exec.Cmd).Env, "GOFLAGS="+scenario.GOFLAGS)
 			require.Contains(t, mockCmd.(*exec.Cmd).Env, "GOPATH="+scenario.Gopath())
+			require.Contains(t, mockCmd.(*exec.Cmd).Env, "HOME="+scenario.Home())
+			require.Contains(t, mockCmd.(*exec.Cmd).Env, "XDG_CONFIG_HOME="+scenario.XdgConfigHome())
+			require.Contains(t, mockCmd.(*exec.Cmd).Env, "GOENV="+scenario.Goenv())
 			require.Contains(t, mockCmd.(*exec.Cmd).Dir, scenario.Wd())
 			require.Exactly(t, cmd.Args, mockCmd.(*exec.Cmd).Args)
 		}
@@ -74,6 +78,9 @@ func (s *CmdSuite) TestScenarioApplied() {
 			require.Contains(t, mockCmd.(*exec.Cmd).Env, "GO111MODULE="+scenario.GO111MODULE)
 			require.Contains(t, mockCmd.(*exec.Cmd).Env, "GOFLAGS="+scenario.GOFLAGS)
 			require.Contains(t, mockCmd.(*exec.Cmd).Env, "GOPATH="+scenario.Gopath())
+			require.Contains(t, mockCmd.(*exec.Cmd).Env, "HOME="+scenario.Home())
+			require.Contains(t, mockCmd.(*exec.Cmd).Env, "XDG_CONFIG_HOME="+scenario.XdgConfigHome())
+			require.Contains(t, mockCmd.(*exec.Cmd).Env, "GOENV="+scenario.Goenv())
 			require.Contains(t, mockCmd.(*exec.Cmd).Dir, scenario.Wd())
 			require.Exactly(t, cmd.Args, mockCmd.(*exec.Cmd).Args)
 		}
@@ -0,0 +1,414 @@
+// Copyright (C) 2019 The gomodfuzz Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package gomodfuzz
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultImportPath is used when Config.ImportPath is empty.
+	DefaultImportPath = "example.com/gomodfuzz/wd"
+
+	// PatternPlaceholder is replaced in the subject's arguments by the package pattern selected by
+	// Scenario.PATTERN, e.g. "./...", if Config.Patterns is non-empty.
+	PatternPlaceholder = "{pattern}"
+)
+
+// Config selects the optional axes, and their values, which are permuted in addition to
+// GO111MODULE, GOFLAGS, GOPATH, IN_MODULE, and WD.
+//
+// An optional axis is disabled if its value list is empty. Disabled axes are absent from
+// PermuteAxes, and display strings, and their Scenario fields keep zero values.
+type Config struct {
+	// Layouts holds the LAYOUT axis values, e.g. GopathSrcLayout.
+	Layouts []int
+
+	// ImportPath is the package import path used by layouts which place the working directory
+	// at GOPATH/src/<import path>. It is also the go.mod module path in layouts where the two should match.
+	ImportPath string
+
+	// Goenvs holds the GOENV axis values, e.g. WrittenGoenv.
+	Goenvs []int
+
+	// GoenvSettings holds "KEY=VALUE" lines, in the format written by `go env -w`, which WrittenGoenv
+	// writes into the scenario's isolated GOENV file.
+	GoenvSettings []string
+
+	// Modcaches holds the MODCACHE axis values, e.g. SeededModcache.
+	Modcaches []int
+
+	// SharedGocache is true if all scenarios should share one GOCACHE, e.g. to save time on builds.
+	// Module cache state is never shared.
+	SharedGocache bool
+
+	// FixtureModules holds the modules which scenarios may depend on, e.g. to seed GOMODCACHE.
+	//
+	// The lowest version of each module is required by go.mod files created in the working directory.
+	FixtureModules []FixtureModule
+
+	// Goproxies holds the GOPROXY axis values, e.g. FileGoproxy.
+	Goproxies []int
+
+	// Privates holds the PRIVATE axis values, e.g. GonosumdbModules.
+	Privates []int
+
+	// ProxyFaults holds the PROXY_FAULT axis values, e.g. CorruptZipProxyFault.
+	ProxyFaults []int
+
+	// ProxyURL is the ProxyServer.URL value used by HTTPGoproxy.
+	ProxyURL string
+
+	// Vcses holds the VCS axis values, e.g. DirtyVcs.
+	Vcses []int
+
+	// UnsetEnvAxes is true if the GO111MODULE, GOFLAGS, and GOPATH axes should also include a value which
+	// removes the variable from the environment, e.g. so a host value is not inherited.
+	UnsetEnvAxes bool
+
+	// InvalidEnvAxes is true if the GO111MODULE, GOFLAGS, and GOPATH axes should also include invalid values,
+	// e.g. InvalidGo111module and RelativeGopath.
+	InvalidEnvAxes bool
+
+	// Goroot is the GOPATH value selected by GorootGopath, e.g. from `go env GOROOT`.
+	Goroot string
+
+	// Hermetic is true if scenarios should inherit only a minimal host environment (PATH, HOME, TMPDIR),
+	// plus PassEnv, instead of all host variables, so results do not depend on the invoking shell.
+	Hermetic bool
+
+	// PassEnv holds the names of additional host environment variables inherited if Hermetic is true.
+	PassEnv []string
+
+	// Env holds "KEY=VALUE" variables which scenarios add to the host environment, e.g. for the subject's own settings.
+	//
+	// Permutation-defined variables take precedence.
+	Env []string
+
+	// TemplateArgs is true if the subject's arguments are text/templates which are executed with the Scenario
+	// as data, e.g. "--root={{.Wd}}". It is opt-in because subjects such as `go list -f` take templates of their own.
+	TemplateArgs bool
+
+	// TemplateEnv is true if the Env values are text/templates which are executed with the Scenario as data,
+	// e.g. "{{.Wd}}/out.json". It is opt-in for the same reason as TemplateArgs, e.g. "FMT={{.Dir}}" may be
+	// intended for the subject's own templates.
+	TemplateEnv bool
+
+	// Goflags holds flags, e.g. "-mod=mod" or "-modfile=alt.mod", from which the GOFLAGS axis values are composed
+	// instead of the defaults. A relative "-modfile" path is created in the working directory.
+	Goflags []string
+
+	// GoflagsCompose selects how Goflags are combined, e.g. PairGoflags.
+	GoflagsCompose int
+
+	// BuildvcsFalse is true if the GOFLAGS axis should also include "-buildvcs=false" values, e.g. to
+	// compare VCS axis results with and without VCS stamping.
+	BuildvcsFalse bool
+
+	// GoDirectives holds the GO_DIRECTIVE axis values, e.g. Go117GoDirective.
+	GoDirectives []int
+
+	// Toolchains holds the TOOLCHAIN axis values, e.g. NewerLocalToolchain.
+	Toolchains []int
+
+	// PathShapes holds the PATH_SHAPE axis values, e.g. SymlinkWdPathShape.
+	PathShapes []int
+
+	// SpecialDirs holds the SPECIAL_DIR axis values, e.g. TestdataSpecialDir.
+	SpecialDirs []int
+
+	// NestedModules holds the NESTED_MODULE axis values, e.g. ReplacedNestedModule.
+	NestedModules []int
+
+	// ModDirectives holds the MOD_DIRECTIVE axis values, e.g. ReplaceRelativeModDirective.
+	ModDirectives []int
+
+	// MajorVersions holds the MAJOR_VERSION axis values, e.g. SubdirMajorVersion.
+	MajorVersions []int
+
+	// Gosums holds the GOSUM axis values, e.g. MissingEntryGosum.
+	Gosums []int
+
+	// MalformedGomods holds the MALFORMED_GOMOD axis values, e.g. SyntaxMalformedGomod.
+	MalformedGomods []int
+
+	// Platforms holds the PLATFORM axis values, e.g. WindowsAmd64Platform.
+	Platforms []int
+
+	// Cgos holds the CGO axis values, e.g. DisabledCgo.
+	Cgos []int
+
+	// ReadOnlys holds the READ_ONLY axis values, e.g. WdReadOnly.
+	ReadOnlys []int
+
+	// Ttys holds the TTY axis values, e.g. PtyTty.
+	Ttys []int
+
+	// Patterns holds the PATTERN axis values, e.g. ImportPathPattern.
+	Patterns []int
+}
+
+// modeNames indexes the display/CLI names of optional axis modes, first by axis name and then by mode.
+var modeNames = map[string]map[int]string{
+	"LAYOUT": {
+		FlatLayout:              "flat",
+		GopathSrcLayout:         "gopath_src",
+		GopathSrcMismatchLayout: "gopath_src_mismatch",
+		ShadowedLayout:          "shadowed",
+	},
+	"GOENV": {
+		EmptyGoenv:   "empty",
+		WrittenGoenv: "written",
+	},
+	"MODCACHE": {
+		EmptyModcache:    "empty",
+		SeededModcache:   "seeded",
+		ReadOnlyModcache: "readonly",
+	},
+	"GOPROXY": {
+		OffGoproxy:    "off",
+		DirectGoproxy: "direct",
+		FileGoproxy:   "file",
+		HTTPGoproxy:   "http",
+		UnsetGoproxy:  "unset",
+	},
+	"PRIVATE": {
+		PublicModules:       "none",
+		GoprivateModules:    "goprivate",
+		GonosumdbModules:    "gonosumdb",
+		GoinsecureModules:   "goinsecure",
+		UnsetPrivateModules: "unset",
+	},
+	"PROXY_FAULT": {
+		NoProxyFault:           "none",
+		NotFoundProxyFault:     "404",
+		GoneProxyFault:         "410",
+		SlowProxyFault:         "slow",
+		TruncatedZipProxyFault: "truncated_zip",
+		CorruptZipProxyFault:   "corrupt_zip",
+		SumMismatchProxyFault:  "sum_mismatch",
+	},
+	"VCS": {
+		NoVcs:     "none",
+		CleanVcs:  "clean",
+		DirtyVcs:  "dirty",
+		SubdirVcs: "subdir",
+		UnsafeVcs: "unsafe",
+	},
+	"GO_DIRECTIVE": {
+		NoGoDirective:    "absent",
+		Go111GoDirective: "1.11",
+		Go114GoDirective: "1.14",
+		Go117GoDirective: "1.17",
+		Go121GoDirective: "1.21",
+		NewerGoDirective: "newer",
+	},
+	"TOOLCHAIN": {
+		NoToolchain:         "absent",
+		NewerToolchain:      "newer",
+		NewerLocalToolchain: "newer_local",
+	},
+	"PATH_SHAPE": {
+		PlainPathShape:         "plain",
+		SpacesPathShape:        "spaces",
+		UnicodePathShape:       "unicode",
+		SymlinkWdPathShape:     "symlink_wd",
+		SymlinkGopathPathShape: "symlink_gopath",
+		LongPathShape:          "long",
+	},
+	"SPECIAL_DIR": {
+		NoSpecialDir:         "none",
+		PackageSpecialDir:    "pkg",
+		TestdataSpecialDir:   "testdata",
+		UnderscoreSpecialDir: "_x",
+		DotSpecialDir:        ".x",
+		VendorSpecialDir:     "vendor",
+	},
+	"NESTED_MODULE": {
+		NoNestedModule:       "none",
+		InsideNestedModule:   "inside",
+		ParentNestedModule:   "parent",
+		ReplacedNestedModule: "replaced",
+	},
+	"MOD_DIRECTIVE": {
+		NoModDirective:              "none",
+		ReplaceRelativeModDirective: "replace_relative",
+		ReplaceAbsoluteModDirective: "replace_absolute",
+		ReplaceVersionModDirective:  "replace_version",
+		ExcludeModDirective:         "exclude",
+		RetractModDirective:         "retract",
+	},
+	"MAJOR_VERSION": {
+		NoMajorVersion:     "none",
+		SubdirMajorVersion: "subdir",
+		BranchMajorVersion: "branch",
+		DepMajorVersion:    "dep",
+	},
+	"GOSUM": {
+		NoGosum:           "absent",
+		CompleteGosum:     "complete",
+		MissingEntryGosum: "missing_entry",
+		WrongHashGosum:    "wrong_hash",
+	},
+	"MALFORMED_GOMOD": {
+		NoMalformedGomod:               "none",
+		SyntaxMalformedGomod:           "syntax",
+		NoModuleMalformedGomod:         "no_module",
+		UnknownDirectiveMalformedGomod: "unknown_directive",
+		DuplicateRequireMalformedGomod: "duplicate_require",
+		InvalidGoMalformedGomod:        "invalid_go",
+	},
+	"PLATFORM": {
+		HostPlatform:         "host",
+		LinuxAmd64Platform:   "linux_amd64",
+		WindowsAmd64Platform: "windows_amd64",
+		DarwinArm64Platform:  "darwin_arm64",
+	},
+	"CGO": {
+		InheritedCgo: "inherit",
+		EnabledCgo:   "enabled",
+		DisabledCgo:  "disabled",
+	},
+	"READ_ONLY": {
+		NoReadOnly:         "none",
+		WdReadOnly:         "wd",
+		ModuleRootReadOnly: "module_root",
+		GopathReadOnly:     "gopath",
+		ModcacheReadOnly:   "modcache",
+	},
+	"TTY": {
+		PipeTty: "pipe",
+		PtyTty:  "pty",
+	},
+	"PATTERN": {
+		DotPattern:          "dot",
+		DotRecursivePattern: "dot_recursive",
+		ImportPathPattern:   "import_path",
+		AbsDirPattern:       "abs_dir",
+		RelDirPattern:       "rel_dir",
+	},
+}
+
+// ModeName returns the display/CLI name of an optional axis mode.
+func ModeName(axis string, mode int) string {
+	if name, ok := modeNames[axis][mode]; ok {
+		return name
+	}
+	panic(errors.Errorf("scenario generator used an invalid %s mode [%d]", axis, mode))
+}
+
+// ModeNames returns the display/CLI names of all modes of an optional axis, sorted by mode.
+func ModeNames(axis string) (names []string) {
+	var modes []int
+	for mode := range modeNames[axis] {
+		modes = append(modes, mode)
+	}
+	sort.Ints(modes)
+	for _, mode := range modes {
+		names = append(names, modeNames[axis][mode])
+	}
+	return names
+}
+
+// ParseModes converts display/CLI names of an optional axis's modes into mode values.
+func ParseModes(axis string, names []string) (modes []int, err error) {
+	for _, name := range names {
+		var found bool
+		for mode, modeName := range modeNames[axis] {
+			if modeName == strings.TrimSpace(name) {
+				modes = append(modes, mode)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, errors.Errorf("invalid %s mode [%s], expected one of: %s", axis, name, strings.Join(ModeNames(axis), ", "))
+		}
+	}
+	return modes, nil
+}
+
+// optionalAxes holds the names of all optional axes in permutation order.
+var optionalAxes = []string{"LAYOUT", "GOENV", "MODCACHE", "GOPROXY", "PRIVATE", "PROXY_FAULT", "VCS", "GO_DIRECTIVE", "TOOLCHAIN", "PATH_SHAPE", "SPECIAL_DIR", "NESTED_MODULE", "MOD_DIRECTIVE", "MAJOR_VERSION", "GOSUM", "MALFORMED_GOMOD", "PLATFORM", "CGO", "READ_ONLY", "TTY", "PATTERN"}
+
+// axes returns the names of enabled optional axes in permutation order.
+func (c Config) axes() (names []string) {
+	for _, axis := range optionalAxes {
+		if len(c.modes(axis)) > 0 {
+			names = append(names, axis)
+		}
+	}
+	return names
+}
+
+// modes returns the selected modes of an optional axis.
+func (c Config) modes(axis string) []int {
+	switch axis {
+	case "LAYOUT":
+		return c.Layouts
+	case "GOENV":
+		return c.Goenvs
+	case "MODCACHE":
+		return c.Modcaches
+	case "GOPROXY":
+		return c.Goproxies
+	case "PRIVATE":
+		return c.Privates
+	case "PROXY_FAULT":
+		return c.ProxyFaults
+	case "VCS":
+		return c.Vcses
+	case "GO_DIRECTIVE":
+		return c.GoDirectives
+	case "TOOLCHAIN":
+		return c.Toolchains
+	case "PATH_SHAPE":
+		return c.PathShapes
+	case "SPECIAL_DIR":
+		return c.SpecialDirs
+	case "NESTED_MODULE":
+		return c.NestedModules
+	case "MOD_DIRECTIVE":
+		return c.ModDirectives
+	case "MAJOR_VERSION":
+		return c.MajorVersions
+	case "GOSUM":
+		return c.Gosums
+	case "MALFORMED_GOMOD":
+		return c.MalformedGomods
+	case "PLATFORM":
+		return c.Platforms
+	case "CGO":
+		return c.Cgos
+	case "READ_ONLY":
+		return c.ReadOnlys
+	case "TTY":
+		return c.Ttys
+	case "PATTERN":
+		return c.Patterns
+	}
+	return nil
+}
+
+// values returns the selected values of an optional axis.
+func (c Config) values(axis string) (values []interface{}) {
+	for _, mode := range c.modes(axis) {
+		values = append(values, mode)
+	}
+	return values
+}
+
+// importPath returns ImportPath or its default.
+func (c Config) importPath() string {
+	if c.ImportPath == "" {
+		return DefaultImportPath
+	}
+	return c.ImportPath
+}
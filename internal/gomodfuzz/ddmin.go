@@ -0,0 +1,203 @@
+// Copyright (C) 2019 The gomodfuzz Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package gomodfuzz
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Ddmin returns a 1-minimal subset of the items for which the test returns true, i.e. removing any one
+// item from the subset makes the test return false. It implements Zeller's delta debugging algorithm.
+//
+// The test must return true for the full item list. Each distinct subset is tested at most once.
+func Ddmin(items []string, test func(subset []string) (bool, error)) ([]string, error) {
+	tested := map[string]bool{}
+	cachedTest := func(subset []string) (bool, error) {
+		key := strings.Join(subset, "\x00")
+		if result, ok := tested[key]; ok {
+			return result, nil
+		}
+		result, err := test(subset)
+		if err != nil {
+			return false, errors.WithStack(err)
+		}
+		tested[key] = result
+		return result, nil
+	}
+
+	items = append([]string{}, items...)
+	n := 2
+
+	for len(items) >= 2 {
+		chunks := splitItems(items, n)
+		reduced := false
+
+		// Try to reduce to one chunk, then to the complement of one chunk.
+
+		for _, chunk := range chunks {
+			ok, err := cachedTest(chunk)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+			if ok {
+				items, n, reduced = chunk, 2, true
+				break
+			}
+		}
+
+		if !reduced && n > 2 {
+			for c := range chunks {
+				var complement []string
+				for other, chunk := range chunks {
+					if other != c {
+						complement = append(complement, chunk...)
+					}
+				}
+				ok, err := cachedTest(complement)
+				if err != nil {
+					return nil, errors.WithStack(err)
+				}
+				if ok {
+					items, reduced = complement, true
+					if n--; n < 2 {
+						n = 2
+					}
+					break
+				}
+			}
+		}
+
+		if !reduced {
+			if n >= len(items) {
+				break
+			}
+			if n *= 2; n > len(items) {
+				n = len(items)
+			}
+		}
+	}
+
+	return items, nil
+}
+
+// splitItems divides the items into n chunks of nearly equal length, preserving order.
+func splitItems(items []string, n int) (chunks [][]string) {
+	start := 0
+	for c := 0; c < n; c++ {
+		end := start + (len(items)-start)/(n-c)
+		chunks = append(chunks, items[start:end])
+		start = end
+	}
+	return chunks
+}
+
+// EnvCauses identifies which inherited host environment variables cause a scenario failure.
+type EnvCauses struct {
+	// Required holds the names of a minimal set of host variables which reproduce the failure if only
+	// they are inherited. It is empty if the failure occurs without inheriting any candidate variables.
+	Required []string
+
+	// Removal holds the names of a minimal set of host variables whose removal makes the scenario pass.
+	// It is empty if RemovalFound is false.
+	Removal []string
+
+	// RemovalFound is false if the scenario fails even without inheriting any candidate variables.
+	RemovalFound bool
+
+	// Candidates holds the names of all host variables which were considered.
+	Candidates []string
+}
+
+// DebugHostEnv finds the host environment variables which cause a scenario failure.
+//
+// The fails function reports whether the scenario fails if it inherits the input host "KEY=VALUE" pairs,
+// e.g. by running it with Scenario.WithHostEnv. The host variables always inherited by hermetic
+// scenarios (PATH, HOME, TMPDIR) are not candidates, so the go command and subject can still be found.
+func DebugHostEnv(host []string, fails func(host []string) (bool, error)) (causes EnvCauses, err error) {
+	fixed, _ := HermeticEnv(host, nil)
+
+	values := map[string]string{}
+	for _, pair := range host {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || hasName(hermeticEnvNames, parts[0]) {
+			continue
+		}
+		if _, ok := values[parts[0]]; ok {
+			continue
+		}
+		values[parts[0]] = parts[1]
+		causes.Candidates = append(causes.Candidates, parts[0])
+	}
+	sort.Strings(causes.Candidates)
+
+	// withNames returns the host environment limited to the fixed variables and the named candidates.
+	withNames := func(names []string) []string {
+		env := append([]string{}, fixed...)
+		for _, name := range names {
+			env = append(env, name+"="+values[name])
+		}
+		return env
+	}
+
+	// without returns the candidates except the named ones.
+	without := func(names []string) (rest []string) {
+		for _, name := range causes.Candidates {
+			if !hasName(names, name) {
+				rest = append(rest, name)
+			}
+		}
+		return rest
+	}
+
+	allFail, err := fails(withNames(causes.Candidates))
+	if err != nil {
+		return EnvCauses{}, errors.WithStack(err)
+	}
+	if !allFail {
+		return EnvCauses{}, errors.New("scenario did not fail with the full host environment")
+	}
+
+	noneFail, err := fails(withNames(nil))
+	if err != nil {
+		return EnvCauses{}, errors.WithStack(err)
+	}
+	if noneFail {
+		// The failure does not depend on the candidates, so no removal can make it pass.
+		return causes, nil
+	}
+
+	causes.Required, err = Ddmin(causes.Candidates, func(names []string) (bool, error) {
+		return fails(withNames(names))
+	})
+	if err != nil {
+		return EnvCauses{}, errors.Wrap(err, "failed to find required host variables")
+	}
+
+	causes.Removal, err = Ddmin(causes.Candidates, func(names []string) (bool, error) {
+		failed, testErr := fails(withNames(without(names)))
+		return !failed, testErr
+	})
+	if err != nil {
+		return EnvCauses{}, errors.Wrap(err, "failed to find host variables whose removal passes")
+	}
+	causes.RemovalFound = true
+
+	return causes, nil
+}
+
+// hasName returns true if the name is in the list.
+func hasName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
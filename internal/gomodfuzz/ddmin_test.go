@@ -0,0 +1,101 @@
+// Copyright (C) 2019 The gomodfuzz Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package gomodfuzz_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/codeactual/gomodfuzz/internal/gomodfuzz"
+)
+
+// containsAll returns true if the list contains all the input items.
+func containsAll(list []string, items ...string) bool {
+	for _, item := range items {
+		var found bool
+		for _, candidate := range list {
+			if candidate == item {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func TestDdmin(t *testing.T) {
+	items := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+
+	var tests int
+	min, err := gomodfuzz.Ddmin(items, func(subset []string) (bool, error) {
+		tests++
+		return containsAll(subset, "c", "g"), nil
+	})
+	require.NoError(t, err)
+	require.Exactly(t, []string{"c", "g"}, min)
+	require.True(t, tests < 1<<uint(len(items)))
+
+	min, err = gomodfuzz.Ddmin(items, func(subset []string) (bool, error) {
+		return containsAll(subset, "h"), nil
+	})
+	require.NoError(t, err)
+	require.Exactly(t, []string{"h"}, min)
+
+	min, err = gomodfuzz.Ddmin(items, func(subset []string) (bool, error) {
+		return len(subset) == len(items), nil
+	})
+	require.NoError(t, err)
+	require.Exactly(t, items, min)
+
+	_, err = gomodfuzz.Ddmin(items, func(subset []string) (bool, error) {
+		return false, errors.New("test error")
+	})
+	require.EqualError(t, err, "test error")
+}
+
+func TestDebugHostEnv(t *testing.T) {
+	host := []string{"PATH=/bin", "HOME=/home/user", "GOFLAGS=-mod=vendor", "A=1", "B=2", "GONOSUMDB=x", "C=3"}
+
+	// names returns the variable names in "KEY=VALUE" pairs.
+	names := func(pairs []string) (names []string) {
+		for _, pair := range pairs {
+			names = append(names, strings.SplitN(pair, "=", 2)[0])
+		}
+		return names
+	}
+
+	// The failure requires GOFLAGS and GONOSUMDB.
+	causes, err := gomodfuzz.DebugHostEnv(host, func(env []string) (bool, error) {
+		require.True(t, containsAll(names(env), "PATH", "HOME"))
+		return containsAll(env, "GOFLAGS=-mod=vendor", "GONOSUMDB=x"), nil
+	})
+	require.NoError(t, err)
+	require.Exactly(t, []string{"A", "B", "C", "GOFLAGS", "GONOSUMDB"}, causes.Candidates)
+	require.Exactly(t, []string{"GOFLAGS", "GONOSUMDB"}, causes.Required)
+	require.True(t, causes.RemovalFound)
+	require.Len(t, causes.Removal, 1)
+	require.Contains(t, []string{"GOFLAGS", "GONOSUMDB"}, causes.Removal[0])
+
+	// The failure does not depend on the host environment.
+	causes, err = gomodfuzz.DebugHostEnv(host, func(env []string) (bool, error) {
+		return true, nil
+	})
+	require.NoError(t, err)
+	require.Empty(t, causes.Required)
+	require.False(t, causes.RemovalFound)
+
+	// The scenario does not fail at all.
+	_, err = gomodfuzz.DebugHostEnv(host, func(env []string) (bool, error) {
+		return false, nil
+	})
+	require.EqualError(t, err, "scenario did not fail with the full host environment")
+}
@@ -0,0 +1,110 @@
+// Copyright (C) 2019 The gomodfuzz Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package gomodfuzz
+
+import (
+	"sort"
+	"strings"
+)
+
+// hermeticEnvNames holds the names of host environment variables which hermetic scenarios always inherit.
+//
+// HOME is replaced by the scenario's isolated HOME but is listed so it is not reported as dropped.
+var hermeticEnvNames = []string{"PATH", "HOME", "TMPDIR"}
+
+// Env is an ordered list of environment variables in which each name appears at most once.
+//
+// Unlike appending to an os.Environ slice, assigning an existing name replaces its value in place,
+// and a variable can be removed entirely instead of only being assigned an empty value.
+type Env struct {
+	// names holds the variable names in the order they were first assigned.
+	names []string
+
+	// values holds the variable values indexed by name.
+	values map[string]string
+}
+
+// NewEnv returns an Env initialized with "KEY=VALUE" pairs, e.g. from os.Environ.
+func NewEnv(pairs []string) *Env {
+	e := &Env{values: map[string]string{}}
+	e.SetPairs(pairs)
+	return e
+}
+
+// Set assigns a variable's value.
+func (e *Env) Set(name, value string) {
+	if _, ok := e.values[name]; !ok {
+		e.names = append(e.names, name)
+	}
+	e.values[name] = value
+}
+
+// SetPairs assigns the values of "KEY=VALUE" pairs. Pairs without a "=" are ignored.
+func (e *Env) SetPairs(pairs []string) {
+	for _, pair := range pairs {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		e.Set(parts[0], parts[1])
+	}
+}
+
+// Unset removes a variable.
+func (e *Env) Unset(name string) {
+	if _, ok := e.values[name]; !ok {
+		return
+	}
+	delete(e.values, name)
+	for n, existing := range e.names {
+		if existing == name {
+			e.names = append(e.names[:n], e.names[n+1:]...)
+			break
+		}
+	}
+}
+
+// Lookup returns a variable's value and true if it is set.
+func (e *Env) Lookup(name string) (string, bool) {
+	value, ok := e.values[name]
+	return value, ok
+}
+
+// Names returns the variable names in the order they were first assigned.
+func (e *Env) Names() []string {
+	return append([]string{}, e.names...)
+}
+
+// Environ returns the variables in "KEY=VALUE" format, e.g. for os/exec.Cmd.Env.
+func (e *Env) Environ() []string {
+	environ := make([]string, 0, len(e.names))
+	for _, name := range e.names {
+		environ = append(environ, name+"="+e.values[name])
+	}
+	return environ
+}
+
+// HermeticEnv returns the host "KEY=VALUE" pairs which hermetic scenarios inherit: the minimal variables
+// (PATH, HOME, TMPDIR) and those named in the pass list. It also returns the sorted names of the dropped variables.
+func HermeticEnv(host, pass []string) (kept, dropped []string) {
+	allowed := map[string]bool{}
+	for _, name := range append(append([]string{}, hermeticEnvNames...), pass...) {
+		allowed[name] = true
+	}
+
+	for _, pair := range host {
+		name := strings.SplitN(pair, "=", 2)[0]
+		if allowed[name] {
+			kept = append(kept, pair)
+		} else {
+			dropped = append(dropped, name)
+		}
+	}
+	sort.Strings(dropped)
+
+	return kept, dropped
+}
@@ -0,0 +1,48 @@
+// Copyright (C) 2019 The gomodfuzz Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package gomodfuzz_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/codeactual/gomodfuzz/internal/gomodfuzz"
+)
+
+func TestEnv(t *testing.T) {
+	env := gomodfuzz.NewEnv([]string{"A=1", "GOFLAGS=-mod=mod", "B=2", "A=3", "INVALID", "EMPTY="})
+
+	require.Exactly(t, []string{"A=3", "GOFLAGS=-mod=mod", "B=2", "EMPTY="}, env.Environ())
+
+	env.Set("GOFLAGS", "")
+	env.Set("C", "4")
+	env.Unset("B")
+	env.Unset("NEVER_SET")
+
+	require.Exactly(t, []string{"A=3", "GOFLAGS=", "EMPTY=", "C=4"}, env.Environ())
+	require.Exactly(t, []string{"A", "GOFLAGS", "EMPTY", "C"}, env.Names())
+
+	value, ok := env.Lookup("GOFLAGS")
+	require.True(t, ok)
+	require.Exactly(t, "", value)
+
+	_, ok = env.Lookup("B")
+	require.False(t, ok)
+}
+
+func TestHermeticEnv(t *testing.T) {
+	host := []string{"PATH=/bin", "GOFLAGS=-mod=mod", "HOME=/home/user", "CGO_ENABLED=0", "TMPDIR=/tmp", "SSH_AUTH_SOCK=/sock"}
+
+	kept, dropped := gomodfuzz.HermeticEnv(host, []string{"SSH_AUTH_SOCK", "NOT_IN_HOST"})
+	require.Exactly(t, []string{"PATH=/bin", "HOME=/home/user", "TMPDIR=/tmp", "SSH_AUTH_SOCK=/sock"}, kept)
+	require.Exactly(t, []string{"CGO_ENABLED", "GOFLAGS"}, dropped)
+
+	kept, dropped = gomodfuzz.HermeticEnv(host, nil)
+	require.Exactly(t, []string{"PATH=/bin", "HOME=/home/user", "TMPDIR=/tmp"}, kept)
+	require.Exactly(t, []string{"CGO_ENABLED", "GOFLAGS", "SSH_AUTH_SOCK"}, dropped)
+}
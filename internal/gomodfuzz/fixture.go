@@ -0,0 +1,328 @@
+// Copyright (C) 2019 The gomodfuzz Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package gomodfuzz
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"golang.org/x/mod/semver"
+)
+
+const (
+	// fixtureTime is the timestamp in generated .info files. It is constant so generated trees are reproducible.
+	fixtureTime = "2019-01-01T00:00:00Z"
+
+	// modcacheDirPerm and modcacheFilePerm match the go command's permissions for extracted module directories.
+	modcacheDirPerm  = 0555
+	modcacheFilePerm = 0444
+)
+
+// FixtureModule is one version of a module whose source tree is on local disk.
+type FixtureModule struct {
+	// Path is the module path, e.g. "example.com/dep".
+	Path string
+
+	// Version is the semantic version, e.g. "v1.0.0".
+	Version string
+
+	// Dir is the module's source tree, which contains its go.mod.
+	Dir string
+}
+
+// String returns the "<path>@<version>" form of the module.
+func (m FixtureModule) String() string {
+	return m.Path + "@" + m.Version
+}
+
+// LoadFixtureModules finds module source trees in the input directory.
+//
+// Each tree's location relative to the input directory must follow the "<module path>@<version>"
+// convention of the module cache, e.g. "<dir>/example.com/dep@v1.0.0/go.mod". Unlike the module cache,
+// upper-case letters are not escaped.
+func LoadFixtureModules(dir string) (mods []FixtureModule, err error) {
+	walkErr := filepath.Walk(dir, func(p string, info os.FileInfo, walkErr error) error {
+		if walkErr != nil {
+			return errors.Wrapf(walkErr, "failed to walk [%s]", p)
+		}
+		if !info.IsDir() || !strings.Contains(info.Name(), "@") {
+			return nil
+		}
+
+		relPath, relErr := filepath.Rel(dir, p)
+		if relErr != nil {
+			return errors.Wrapf(relErr, "failed to get relative path from [%s] to [%s]", dir, p)
+		}
+
+		parts := strings.SplitN(filepath.ToSlash(relPath), "@", 2)
+		mod := FixtureModule{Path: parts[0], Version: parts[1], Dir: p}
+
+		if _, statErr := os.Stat(filepath.Join(p, "go.mod")); statErr != nil {
+			return errors.Wrapf(statErr, "fixture module [%s] has no go.mod", mod)
+		}
+
+		mods = append(mods, mod)
+
+		return filepath.SkipDir
+	})
+	if walkErr != nil {
+		return nil, errors.WithStack(walkErr)
+	}
+
+	if len(mods) == 0 {
+		return nil, errors.Errorf("no fixture modules found in [%s]", dir)
+	}
+
+	sort.Slice(mods, func(i, j int) bool {
+		if mods[i].Path == mods[j].Path {
+			return semver.Compare(mods[i].Version, mods[j].Version) < 0
+		}
+		return mods[i].Path < mods[j].Path
+	})
+
+	return mods, nil
+}
+
+// moduleFiles returns the slash-separated paths, relative to the module root, of all regular files in the module.
+func (m FixtureModule) moduleFiles() (names []string, err error) {
+	walkErr := filepath.Walk(m.Dir, func(p string, info os.FileInfo, walkErr error) error {
+		if walkErr != nil {
+			return errors.Wrapf(walkErr, "failed to walk [%s]", p)
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		relPath, relErr := filepath.Rel(m.Dir, p)
+		if relErr != nil {
+			return errors.Wrapf(relErr, "failed to get relative path from [%s] to [%s]", m.Dir, p)
+		}
+		names = append(names, filepath.ToSlash(relPath))
+		return nil
+	})
+	if walkErr != nil {
+		return nil, errors.WithStack(walkErr)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// GoMod returns the content of the module's go.mod.
+func (m FixtureModule) GoMod() ([]byte, error) {
+	name := filepath.Join(m.Dir, "go.mod")
+	b, err := ioutil.ReadFile(name) // #nosec G304
+	return b, errors.Wrapf(err, "failed to read [%s]", name)
+}
+
+// Zip returns the module zip file in the format served by module proxies.
+func (m FixtureModule) Zip() ([]byte, error) {
+	names, err := m.moduleFiles()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+
+	for _, name := range names {
+		content, readErr := ioutil.ReadFile(filepath.Join(m.Dir, filepath.FromSlash(name))) // #nosec G304
+		if readErr != nil {
+			return nil, errors.Wrapf(readErr, "failed to read fixture module [%s] file [%s]", m, name)
+		}
+		f, createErr := w.Create(m.String() + "/" + name)
+		if createErr != nil {
+			return nil, errors.Wrapf(createErr, "failed to add [%s] to fixture module [%s] zip", name, m)
+		}
+		if _, writeErr := f.Write(content); writeErr != nil {
+			return nil, errors.Wrapf(writeErr, "failed to add [%s] to fixture module [%s] zip", name, m)
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, errors.Wrapf(err, "failed to finalize fixture module [%s] zip", m)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// ZipHash returns the module's go.sum hash, i.e. the "h1:" hash of the zip file's contents.
+func (m FixtureModule) ZipHash() (string, error) {
+	names, err := m.moduleFiles()
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	files := map[string]string{}
+	for _, name := range names {
+		files[m.String()+"/"+name] = filepath.Join(m.Dir, filepath.FromSlash(name))
+	}
+	return hash1(files)
+}
+
+// GoModHash returns the module's "/go.mod" go.sum hash.
+func (m FixtureModule) GoModHash() (string, error) {
+	return hash1(map[string]string{"go.mod": filepath.Join(m.Dir, "go.mod")})
+}
+
+// hash1 returns the "h1:" hash of files, indexed by the names used in the hash, as computed by
+// golang.org/x/mod/sumdb/dirhash.Hash1.
+func hash1(files map[string]string) (string, error) {
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := sha256.New()
+	for _, name := range names {
+		content, err := ioutil.ReadFile(files[name]) // #nosec G304
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to read [%s]", files[name])
+		}
+		fmt.Fprintf(h, "%x  %s\n", sha256.Sum256(content), name)
+	}
+
+	return "h1:" + base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+// escapeModulePath applies the module cache's case-encoding, which replaces each upper-case
+// letter with an exclamation mark followed by the lower-case letter.
+func escapeModulePath(p string) string {
+	var b strings.Builder
+	for _, r := range p {
+		if unicode.IsUpper(r) {
+			b.WriteRune('!')
+			b.WriteRune(unicode.ToLower(r))
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// WriteProxyTree writes the modules into a file tree that follows the GOPROXY protocol, e.g. so it
+// can be used as a "file://" GOPROXY or as the "cache/download" directory of a module cache.
+func WriteProxyTree(mods []FixtureModule, dir string) error {
+	versions := map[string][]string{}
+
+	for _, m := range mods {
+		vDir := filepath.Join(dir, filepath.FromSlash(escapeModulePath(m.Path)), "@v")
+		base := filepath.Join(vDir, escapeModulePath(m.Version))
+
+		goMod, err := m.GoMod()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		zipContent, err := m.Zip()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		zipHash, err := m.ZipHash()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		files := map[string][]byte{
+			base + ".info":    []byte(fmt.Sprintf("{\"Version\":%q,\"Time\":%q}\n", m.Version, fixtureTime)),
+			base + ".mod":     goMod,
+			base + ".zip":     zipContent,
+			base + ".ziphash": []byte(zipHash),
+		}
+		for name, content := range files {
+			if err := writeFileAll(name, content, newFilePerm); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+
+		versions[vDir] = append(versions[vDir], m.Version)
+	}
+
+	for vDir, list := range versions {
+		if err := writeFileAll(filepath.Join(vDir, "list"), []byte(strings.Join(list, "\n")+"\n"), newFilePerm); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+// WriteModuleCache populates a GOMODCACHE directory with the modules, as if they had been downloaded.
+//
+// Extracted module directories are read-only, like those created by the go command.
+func WriteModuleCache(mods []FixtureModule, dir string) error {
+	if err := WriteProxyTree(mods, filepath.Join(dir, "cache", "download")); err != nil {
+		return errors.Wrapf(err, "failed to write module cache downloads in [%s]", dir)
+	}
+
+	for _, m := range mods {
+		names, err := m.moduleFiles()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		modDir := filepath.Join(dir, filepath.FromSlash(escapeModulePath(m.Path))+"@"+escapeModulePath(m.Version))
+
+		for _, name := range names {
+			content, readErr := ioutil.ReadFile(filepath.Join(m.Dir, filepath.FromSlash(name))) // #nosec G304
+			if readErr != nil {
+				return errors.Wrapf(readErr, "failed to read fixture module [%s] file [%s]", m, name)
+			}
+			if err := writeFileAll(filepath.Join(modDir, filepath.FromSlash(name)), content, modcacheFilePerm); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+
+		if err := chmodDirs(modDir, modcacheDirPerm); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+// writeFileAll writes a file and creates all non-existent ancestor directories.
+func writeFileAll(name string, content []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(name), newDirPerm); err != nil {
+		return errors.Wrapf(err, "failed to make directory [%s]", filepath.Dir(name))
+	}
+	return errors.Wrapf(ioutil.WriteFile(name, content, perm), "failed to write file [%s]", name)
+}
+
+// chmodDirs applies the permissions to the directory and all its descendant directories.
+//
+// Descendants are visited before ancestors so that read-only permissions do not prevent the walk.
+// Like the go command's read-only module directories, cage_file.RemoveAllSafer will restore write
+// permission when the stage is removed.
+func chmodDirs(dir string, perm os.FileMode) error {
+	var dirs []string
+	walkErr := filepath.Walk(dir, func(p string, info os.FileInfo, walkErr error) error {
+		if walkErr != nil {
+			return errors.Wrapf(walkErr, "failed to walk [%s]", p)
+		}
+		if info.IsDir() {
+			dirs = append(dirs, p)
+		}
+		return nil
+	})
+	if walkErr != nil {
+		return errors.WithStack(walkErr)
+	}
+	for n := len(dirs) - 1; n >= 0; n-- {
+		if err := os.Chmod(dirs[n], perm); err != nil {
+			return errors.Wrapf(err, "failed to change mode of [%s]", dirs[n])
+		}
+	}
+	return nil
+}
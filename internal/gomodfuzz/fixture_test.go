@@ -0,0 +1,135 @@
+// Copyright (C) 2019 The gomodfuzz Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package gomodfuzz_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+
+	cage_file "github.com/codeactual/gomodfuzz/internal/cage/os/file"
+	testkit_file "github.com/codeactual/gomodfuzz/internal/cage/testkit/os/file"
+	testkit_filepath "github.com/codeactual/gomodfuzz/internal/cage/testkit/path/filepath"
+	"github.com/codeactual/gomodfuzz/internal/gomodfuzz"
+)
+
+type FixtureSuite struct {
+	suite.Suite
+}
+
+func (s *FixtureSuite) SetupTest() {
+	testkit_file.ResetTestdata(s.T())
+}
+
+func (s *FixtureSuite) loadModules() []gomodfuzz.FixtureModule {
+	mods, err := gomodfuzz.LoadFixtureModules(filepath.Join(testkit_file.FixtureDataDir(), "modules"))
+	require.NoError(s.T(), err)
+	return mods
+}
+
+func (s *FixtureSuite) TestLoadFixtureModules() {
+	t := s.T()
+
+	mods := s.loadModules()
+	require.Len(t, mods, 2)
+
+	require.Exactly(t, "gomodfuzz.test/dep", mods[0].Path)
+	require.Exactly(t, "v1.0.0", mods[0].Version)
+	require.Exactly(t, "gomodfuzz.test/dep@v1.0.0", mods[0].String())
+
+	require.Exactly(t, "gomodfuzz.test/dep", mods[1].Path)
+	require.Exactly(t, "v1.1.0", mods[1].Version)
+
+	_, err := gomodfuzz.LoadFixtureModules(testkit_file.DynamicDataDir())
+	require.Error(t, err)
+}
+
+func (s *FixtureSuite) TestLoadFixtureModulesSemverOrder() {
+	t := s.T()
+
+	// Versions are ordered by semantic version precedence rather than as strings, e.g. v1.9.0 before v1.10.0.
+	mods, err := gomodfuzz.LoadFixtureModules(filepath.Join(testkit_file.FixtureDataDir(), "modules_semver"))
+	require.NoError(t, err)
+	require.Len(t, mods, 2)
+	require.Exactly(t, "v1.9.0", mods[0].Version)
+	require.Exactly(t, "v1.10.0", mods[1].Version)
+}
+
+func (s *FixtureSuite) TestHashes() {
+	t := s.T()
+
+	mods := s.loadModules()
+
+	// expected values were produced by the go command from a file:// GOPROXY tree written by WriteProxyTree
+
+	zipHash, err := mods[0].ZipHash()
+	require.NoError(t, err)
+	require.Exactly(t, "h1:uvo5zYcoULaCDqLkE1aO3XX07h0FZhhLvX0Tca0owV8=", zipHash)
+
+	goModHash, err := mods[0].GoModHash()
+	require.NoError(t, err)
+	require.Exactly(t, "h1:lIFcxRox3TwK/9mofn+T0uVxtHV/yiUgqXwC+nrNUms=", goModHash)
+
+	zipHash, err = mods[1].ZipHash()
+	require.NoError(t, err)
+	require.Exactly(t, "h1:tSiANUbxFLmGiqjqIwnfF26K8UpVUgf8WqEiI3LYjIw=", zipHash)
+}
+
+func (s *FixtureSuite) TestZip() {
+	t := s.T()
+
+	content, err := s.loadModules()[0].Zip()
+	require.NoError(t, err)
+
+	r, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	require.NoError(t, err)
+
+	var names []string
+	for _, f := range r.File {
+		names = append(names, f.Name)
+	}
+	require.Exactly(t, []string{"gomodfuzz.test/dep@v1.0.0/dep.go", "gomodfuzz.test/dep@v1.0.0/go.mod"}, names)
+}
+
+func (s *FixtureSuite) TestWriteModuleCache() {
+	t := s.T()
+
+	dir := testkit_filepath.Abs(t, filepath.Join(testkit_file.DynamicDataDir(), "modcache"))
+	require.NoError(t, gomodfuzz.WriteModuleCache(s.loadModules(), dir))
+
+	download := filepath.Join(dir, "cache", "download", "gomodfuzz.test", "dep", "@v")
+	for _, name := range []string{"v1.0.0.info", "v1.0.0.mod", "v1.0.0.zip", "v1.0.0.ziphash", "v1.1.0.zip", "list"} {
+		exists, _, err := cage_file.Exists(filepath.Join(download, name))
+		require.NoError(t, err)
+		require.True(t, exists, name)
+	}
+
+	list, err := ioutil.ReadFile(filepath.Join(download, "list"))
+	require.NoError(t, err)
+	require.Exactly(t, "v1.0.0\nv1.1.0\n", string(list))
+
+	extracted := filepath.Join(dir, "gomodfuzz.test", "dep@v1.1.0")
+	goMod, err := ioutil.ReadFile(filepath.Join(extracted, "go.mod"))
+	require.NoError(t, err)
+	require.Exactly(t, "module gomodfuzz.test/dep\n", string(goMod))
+
+	fi, err := os.Stat(extracted)
+	require.NoError(t, err)
+	require.Exactly(t, os.FileMode(0555), fi.Mode().Perm())
+
+	require.NoError(t, cage_file.RemoveAllSafer(dir))
+}
+
+func TestFixtureSuite(t *testing.T) {
+	suite.Run(t, new(FixtureSuite))
+}
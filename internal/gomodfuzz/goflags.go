@@ -0,0 +1,77 @@
+// Copyright (C) 2019 The gomodfuzz Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package gomodfuzz
+
+import (
+	"strings"
+)
+
+// Config.GoflagsCompose modes
+const (
+	// PowerSetGoflags composes GOFLAGS values from every subset of Config.Goflags.
+	PowerSetGoflags = iota
+
+	// PairGoflags composes GOFLAGS values from every subset of Config.Goflags with at most two flags.
+	PairGoflags
+)
+
+// ComposeGoflags returns GOFLAGS values composed from combinations of the input flags, e.g. "-mod=mod -trimpath".
+//
+// Values are ordered by the number of flags they contain, starting with the empty value, and flags in each value
+// keep their input order. Combinations which repeat a flag name, e.g. "-mod=mod -mod=readonly", are omitted.
+func ComposeGoflags(flags []string, compose int) (values []string) {
+	maxSize := len(flags)
+	if compose == PairGoflags && maxSize > 2 {
+		maxSize = 2
+	}
+
+	var collect func(start, size int, combo []string)
+	collect = func(start, size int, combo []string) {
+		if len(combo) == size {
+			values = append(values, strings.Join(combo, " "))
+			return
+		}
+		for n := start; n < len(flags); n++ {
+			if hasGoflag(combo, goflagName(flags[n])) {
+				continue
+			}
+			collect(n+1, size, append(combo[:len(combo):len(combo)], flags[n]))
+		}
+	}
+
+	for size := 0; size <= maxSize; size++ {
+		collect(0, size, nil)
+	}
+
+	return values
+}
+
+// goflagName returns the name of a GOFLAGS flag, e.g. "-mod" for "-mod=vendor".
+func goflagName(flag string) string {
+	return strings.SplitN(flag, "=", 2)[0]
+}
+
+// hasGoflag returns true if a flag in the list has the input name.
+func hasGoflag(flags []string, name string) bool {
+	for _, flag := range flags {
+		if goflagName(flag) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// goflagValue returns the value of the named flag in a GOFLAGS value, or an empty string if it is absent.
+func goflagValue(goflags, name string) string {
+	for _, flag := range strings.Fields(goflags) {
+		parts := strings.SplitN(flag, "=", 2)
+		if parts[0] == name && len(parts) == 2 {
+			return parts[1]
+		}
+	}
+	return ""
+}
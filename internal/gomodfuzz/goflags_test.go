@@ -0,0 +1,55 @@
+// Copyright (C) 2019 The gomodfuzz Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package gomodfuzz_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/codeactual/gomodfuzz/internal/gomodfuzz"
+)
+
+func TestComposeGoflags(t *testing.T) {
+	flags := []string{"-mod=mod", "-mod=readonly", "-trimpath", "-tags=a,b"}
+
+	require.Exactly(t,
+		[]string{
+			"",
+			"-mod=mod",
+			"-mod=readonly",
+			"-trimpath",
+			"-tags=a,b",
+			"-mod=mod -trimpath",
+			"-mod=mod -tags=a,b",
+			"-mod=readonly -trimpath",
+			"-mod=readonly -tags=a,b",
+			"-trimpath -tags=a,b",
+			"-mod=mod -trimpath -tags=a,b",
+			"-mod=readonly -trimpath -tags=a,b",
+		},
+		gomodfuzz.ComposeGoflags(flags, gomodfuzz.PowerSetGoflags),
+	)
+
+	require.Exactly(t,
+		[]string{
+			"",
+			"-mod=mod",
+			"-mod=readonly",
+			"-trimpath",
+			"-tags=a,b",
+			"-mod=mod -trimpath",
+			"-mod=mod -tags=a,b",
+			"-mod=readonly -trimpath",
+			"-mod=readonly -tags=a,b",
+			"-trimpath -tags=a,b",
+		},
+		gomodfuzz.ComposeGoflags(flags, gomodfuzz.PairGoflags),
+	)
+
+	require.Exactly(t, []string{""}, gomodfuzz.ComposeGoflags(nil, gomodfuzz.PowerSetGoflags))
+}
@@ -0,0 +1,196 @@
+// Copyright (C) 2019 The gomodfuzz Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package gomodfuzz
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ProxyServer is a local HTTP GOPROXY which serves a file tree written by WriteProxyTree.
+//
+// The first element of each request path selects a PROXY_FAULT mode, by its ModeName, which is injected
+// into the response. For example, "<URL>/404/example.com/dep/@v/list" responds with 404 Not Found.
+// This allows each scenario to select its fault through its GOPROXY value.
+type ProxyServer struct {
+	// dir is the root of the file tree served to clients.
+	dir string
+
+	// slowDelay is how long SlowProxyFault responses are delayed.
+	slowDelay time.Duration
+
+	listener net.Listener
+	server   *http.Server
+}
+
+// NewProxyServer returns an initialized ProxyServer.
+//
+// The slowDelay should exceed the scenario timeout so SlowProxyFault responses arrive too late.
+func NewProxyServer(dir string, slowDelay time.Duration) *ProxyServer {
+	p := &ProxyServer{dir: dir, slowDelay: slowDelay}
+	p.server = &http.Server{Handler: p}
+	return p
+}
+
+// Start listens on a random loopback port and serves requests in the background.
+func (p *ProxyServer) Start() (err error) {
+	p.listener, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return errors.Wrap(err, "failed to listen for GOPROXY requests")
+	}
+
+	go func() {
+		_ = p.server.Serve(p.listener) // returns http.ErrServerClosed after Close
+	}()
+
+	return nil
+}
+
+// URL returns the GOPROXY value, minus the fault selection path element.
+func (p *ProxyServer) URL() string {
+	return "http://" + p.listener.Addr().String()
+}
+
+// Close stops the server and interrupts all in-progress responses.
+func (p *ProxyServer) Close() error {
+	return errors.WithStack(p.server.Close())
+}
+
+// ServeHTTP responds to GOPROXY protocol requests and injects the selected fault.
+//
+// It implements http.Handler.
+func (p *ProxyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	if len(parts) != 2 {
+		http.NotFound(w, r)
+		return
+	}
+
+	faults, err := ParseModes("PROXY_FAULT", parts[:1])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	fault := faults[0]
+
+	switch fault {
+	case NotFoundProxyFault:
+		http.NotFound(w, r)
+		return
+	case GoneProxyFault:
+		http.Error(w, "gone", http.StatusGone)
+		return
+	case SlowProxyFault:
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(p.slowDelay):
+		}
+	}
+
+	name := filepath.Join(p.dir, filepath.FromSlash(path.Clean("/"+parts[1])))
+
+	content, err := ioutil.ReadFile(name) // #nosec G304
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.NotFound(w, r)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if strings.HasSuffix(name, ".zip") {
+		if content, err = tamperZip(fault, content); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	http.ServeContent(w, r, filepath.Base(name), time.Time{}, bytes.NewReader(content))
+}
+
+// tamperZip applies a zip-related fault to the content of a module zip file.
+func tamperZip(fault int, content []byte) ([]byte, error) {
+	switch fault {
+	case TruncatedZipProxyFault:
+		return content[:len(content)/2], nil
+	case CorruptZipProxyFault:
+		corrupt := make([]byte, len(content))
+		copy(corrupt, content)
+		for n := len(corrupt) / 4; n < len(corrupt)/2; n++ {
+			corrupt[n] ^= 0xff
+		}
+		return corrupt, nil
+	case SumMismatchProxyFault:
+		// Return a valid zip, so only hash verification can detect that the contents differ from go.sum.
+		return appendZipFile(content, "gomodfuzz_tampered.txt", "tampered\n")
+	default:
+		return content, nil
+	}
+}
+
+// appendZipFile returns a copy of the module zip with an additional file in the module root.
+func appendZipFile(content []byte, name, fileContent string) ([]byte, error) {
+	r, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read module zip")
+	}
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+
+	var root string
+	for _, f := range r.File {
+		// Each name begins with "<module path>@<version>/", and only the module path may contain slashes.
+		if at := strings.Index(f.Name, "@"); at != -1 {
+			if slash := strings.Index(f.Name[at:], "/"); slash != -1 {
+				root = f.Name[:at+slash]
+			}
+		}
+
+		src, openErr := f.Open()
+		if openErr != nil {
+			return nil, errors.Wrapf(openErr, "failed to open module zip file [%s]", f.Name)
+		}
+		dst, createErr := w.Create(f.Name)
+		if createErr != nil {
+			return nil, errors.Wrapf(createErr, "failed to copy module zip file [%s]", f.Name)
+		}
+		if _, copyErr := io.Copy(dst, src); copyErr != nil { // #nosec G110
+			return nil, errors.Wrapf(copyErr, "failed to copy module zip file [%s]", f.Name)
+		}
+		_ = src.Close()
+	}
+
+	dst, err := w.Create(root + "/" + name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to add module zip file [%s]", name)
+	}
+	if _, err = dst.Write([]byte(fileContent)); err != nil {
+		return nil, errors.Wrapf(err, "failed to add module zip file [%s]", name)
+	}
+
+	if err = w.Close(); err != nil {
+		return nil, errors.Wrap(err, "failed to finalize module zip")
+	}
+
+	return buf.Bytes(), nil
+}
+
+var _ http.Handler = (*ProxyServer)(nil)
@@ -0,0 +1,132 @@
+// Copyright (C) 2019 The gomodfuzz Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package gomodfuzz_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+
+	testkit_file "github.com/codeactual/gomodfuzz/internal/cage/testkit/os/file"
+	"github.com/codeactual/gomodfuzz/internal/gomodfuzz"
+)
+
+type ProxyServerSuite struct {
+	suite.Suite
+
+	original []byte
+	server   *gomodfuzz.ProxyServer
+}
+
+func (s *ProxyServerSuite) SetupTest() {
+	t := s.T()
+
+	testkit_file.ResetTestdata(t)
+
+	mods, err := gomodfuzz.LoadFixtureModules(filepath.Join(testkit_file.FixtureDataDir(), "modules"))
+	require.NoError(t, err)
+
+	dir := filepath.Join(testkit_file.DynamicDataDir(), "goproxy")
+	require.NoError(t, gomodfuzz.WriteProxyTree(mods, dir))
+
+	s.original, err = mods[0].Zip()
+	require.NoError(t, err)
+
+	s.server = gomodfuzz.NewProxyServer(dir, time.Second)
+	require.NoError(t, s.server.Start())
+}
+
+func (s *ProxyServerSuite) TearDownTest() {
+	require.NoError(s.T(), s.server.Close())
+}
+
+// get returns the response status and body of a request for a file in the fixture module's "@v" directory.
+func (s *ProxyServerSuite) get(client *http.Client, fault, name string) (int, []byte, error) {
+	res, err := client.Get(s.server.URL() + "/" + fault + "/gomodfuzz.test/dep/@v/" + name)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	return res.StatusCode, body, err
+}
+
+func (s *ProxyServerSuite) TestFaults() {
+	t := s.T()
+
+	code, body, err := s.get(http.DefaultClient, "none", "list")
+	require.NoError(t, err)
+	require.Exactly(t, http.StatusOK, code)
+	require.Exactly(t, "v1.0.0\nv1.1.0\n", string(body))
+
+	code, body, err = s.get(http.DefaultClient, "none", "v1.0.0.zip")
+	require.NoError(t, err)
+	require.Exactly(t, http.StatusOK, code)
+	require.Exactly(t, s.original, body)
+
+	code, _, err = s.get(http.DefaultClient, "none", "v9.9.9.zip")
+	require.NoError(t, err)
+	require.Exactly(t, http.StatusNotFound, code)
+
+	code, _, err = s.get(http.DefaultClient, "404", "list")
+	require.NoError(t, err)
+	require.Exactly(t, http.StatusNotFound, code)
+
+	code, _, err = s.get(http.DefaultClient, "410", "list")
+	require.NoError(t, err)
+	require.Exactly(t, http.StatusGone, code)
+
+	code, _, err = s.get(http.DefaultClient, "invalid_fault", "list")
+	require.NoError(t, err)
+	require.Exactly(t, http.StatusBadRequest, code)
+
+	code, body, err = s.get(http.DefaultClient, "truncated_zip", "v1.0.0.zip")
+	require.NoError(t, err)
+	require.Exactly(t, http.StatusOK, code)
+	require.Exactly(t, s.original[:len(s.original)/2], body)
+
+	code, body, err = s.get(http.DefaultClient, "corrupt_zip", "v1.0.0.zip")
+	require.NoError(t, err)
+	require.Exactly(t, http.StatusOK, code)
+	require.Len(t, body, len(s.original))
+	require.NotEqual(t, s.original, body)
+
+	code, body, err = s.get(http.DefaultClient, "sum_mismatch", "v1.0.0.zip")
+	require.NoError(t, err)
+	require.Exactly(t, http.StatusOK, code)
+	r, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	require.NoError(t, err)
+	var names []string
+	for _, f := range r.File {
+		names = append(names, f.Name)
+	}
+	require.Exactly(t, []string{
+		"gomodfuzz.test/dep@v1.0.0/dep.go",
+		"gomodfuzz.test/dep@v1.0.0/go.mod",
+		"gomodfuzz.test/dep@v1.0.0/gomodfuzz_tampered.txt",
+	}, names)
+
+	// non-zip files are not tampered
+	code, body, err = s.get(http.DefaultClient, "sum_mismatch", "v1.0.0.mod")
+	require.NoError(t, err)
+	require.Exactly(t, http.StatusOK, code)
+	require.Exactly(t, "module gomodfuzz.test/dep\n", string(body))
+
+	_, _, err = s.get(&http.Client{Timeout: 100 * time.Millisecond}, "slow", "list")
+	require.Error(t, err)
+}
+
+func TestProxyServerSuite(t *testing.T) {
+	suite.Run(t, new(ProxyServerSuite))
+}
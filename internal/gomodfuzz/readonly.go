@@ -0,0 +1,133 @@
+// Copyright (C) 2019 The gomodfuzz Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package gomodfuzz
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// readOnlyDir returns the directory whose tree READ_ONLY selects, or an empty string if none is selected.
+func (s Scenario) readOnlyDir() string {
+	switch s.READ_ONLY {
+	case NoReadOnly:
+		return ""
+	case WdReadOnly:
+		return s.RealWd()
+	case ModuleRootReadOnly:
+		return s.realModuleRoot()
+	case GopathReadOnly:
+		if s.GOPATH != UsableGopath && s.GOPATH != UnusedGopath {
+			return ""
+		}
+		return s.realGopath()
+	case ModcacheReadOnly:
+		return s.Gomodcache()
+	default:
+		panic(errors.Errorf("scenario generator used an invalid READ_ONLY mode [%d]", s.READ_ONLY))
+	}
+}
+
+// prepareReadOnly removes write permission from the tree selected by READ_ONLY.
+//
+// The directory is created if missing, e.g. an unused GOPATH, so that the command cannot create it either.
+func (s Scenario) prepareReadOnly() error {
+	dir := s.readOnlyDir()
+	if dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(dir, newDirPerm); err != nil {
+		return errors.Wrapf(err, "failed to create read-only directory [%s]", dir)
+	}
+	return errors.WithStack(chmodTree(dir, modcacheDirPerm, modcacheFilePerm))
+}
+
+// chmodTree changes the mode of all regular files and directories in the tree, including the root.
+//
+// It is chmodDirs extended to regular files, e.g. descendants are also changed before their parents.
+func chmodTree(dir string, dirPerm, filePerm os.FileMode) error {
+	var files []string
+	walkErr := filepath.Walk(dir, func(p string, info os.FileInfo, walkErr error) error {
+		if walkErr != nil {
+			return errors.Wrapf(walkErr, "failed to walk [%s]", p)
+		}
+		if info.IsDir() || info.Mode().IsRegular() {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if walkErr != nil {
+		return errors.WithStack(walkErr)
+	}
+	for n := len(files) - 1; n >= 0; n-- {
+		info, err := os.Lstat(files[n])
+		if err != nil {
+			return errors.Wrapf(err, "failed to stat [%s]", files[n])
+		}
+		perm := filePerm
+		if info.IsDir() {
+			perm = dirPerm
+		}
+		if err := os.Chmod(files[n], perm); err != nil {
+			return errors.Wrapf(err, "failed to change mode of [%s]", files[n])
+		}
+	}
+	return nil
+}
+
+// treeSnapshot indexes a description of each file's state, e.g. its mode and size, by its path
+// relative to the snapshot root.
+type treeSnapshot map[string]string
+
+// snapshotTree returns the state of all files in the tree, or an empty snapshot if the root does not exist.
+func snapshotTree(dir string) (treeSnapshot, error) {
+	snap := treeSnapshot{}
+	walkErr := filepath.Walk(dir, func(p string, info os.FileInfo, walkErr error) error {
+		if walkErr != nil {
+			if os.IsNotExist(walkErr) {
+				return nil
+			}
+			return errors.Wrapf(walkErr, "failed to walk [%s]", p)
+		}
+		rel, relErr := filepath.Rel(dir, p)
+		if relErr != nil {
+			return errors.Wrapf(relErr, "failed to get relative path from [%s] to [%s]", dir, p)
+		}
+		if info.IsDir() {
+			// Omit the modification time, which only changes when an entry is created or removed,
+			// because the entry itself is reported.
+			snap[rel] = info.Mode().String()
+		} else {
+			snap[rel] = fmt.Sprintf("%s %d %d", info.Mode(), info.Size(), info.ModTime().UnixNano())
+		}
+		return nil
+	})
+	if walkErr != nil {
+		return nil, errors.WithStack(walkErr)
+	}
+	return snap, nil
+}
+
+// changedPaths returns the sorted paths which were created, removed, or modified since the earlier snapshot.
+func (snap treeSnapshot) changedPaths(earlier treeSnapshot) (paths []string) {
+	for p, state := range snap {
+		if earlierState, ok := earlier[p]; !ok || earlierState != state {
+			paths = append(paths, p)
+		}
+	}
+	for p := range earlier {
+		if _, ok := snap[p]; !ok {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
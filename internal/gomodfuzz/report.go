@@ -0,0 +1,125 @@
+// Copyright (C) 2019 The gomodfuzz Authors.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package gomodfuzz
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// ScenarioIdEnv is the name of the subject environment variable which holds the scenario's ID.
+	ScenarioIdEnv = "GOMODFUZZ_SCENARIO_ID"
+
+	// AxesEnv is the name of the subject environment variable which holds a JSON object of the scenario's
+	// axis labels, as returned by Scenario.AxisLabels, indexed by axis name.
+	AxesEnv = "GOMODFUZZ_AXES"
+
+	// ResultFileEnv is the name of the subject environment variable which holds the path of the file
+	// to which the subject may write a SubjectReport in JSON.
+	ResultFileEnv = "GOMODFUZZ_RESULT_FILE"
+
+	// resultFileName is the name of the file in ScenarioDir at the ResultFileEnv path.
+	resultFileName = "gomodfuzz_result.json"
+)
+
+// SubjectReport is the structured result which the subject, or a wrapper script, may write in JSON
+// to the ResultFileEnv path, e.g. to report more than an exit code.
+type SubjectReport struct {
+	// Pass is the subject's overall verdict, or nil if it only reports checks and metrics.
+	Pass *bool `json:"pass"`
+
+	// Checks holds the subject's named assertions.
+	Checks []SubjectCheck `json:"checks"`
+
+	// Metrics holds the subject's named measurements, e.g. a duration in seconds.
+	Metrics map[string]float64 `json:"metrics"`
+}
+
+// SubjectCheck is one named assertion in a SubjectReport.
+type SubjectCheck struct {
+	// Name identifies the check across scenarios, e.g. "finds_module_root".
+	Name string `json:"name"`
+
+	// Pass is true if the assertion holds.
+	Pass bool `json:"pass"`
+
+	// Message optionally explains the result, e.g. the unexpected value.
+	Message string `json:"message,omitempty"`
+}
+
+// Failed returns true if the report's verdict or any of its checks is a failure.
+func (r SubjectReport) Failed() bool {
+	if r.Pass != nil && !*r.Pass {
+		return true
+	}
+	return len(r.FailedChecks()) > 0
+}
+
+// FailedChecks returns the checks which did not pass, in reported order.
+func (r SubjectReport) FailedChecks() (failed []SubjectCheck) {
+	for _, c := range r.Checks {
+		if !c.Pass {
+			failed = append(failed, c)
+		}
+	}
+	return failed
+}
+
+// MetricNames returns the names of the report's metrics in sorted order.
+func (r SubjectReport) MetricNames() (names []string) {
+	for name := range r.Metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ResultFile returns the ResultFileEnv path.
+func (s Scenario) ResultFile() string {
+	return filepath.Join(s.ScenarioDir(), resultFileName)
+}
+
+// SubjectEnv returns the "KEY=VALUE" variables which describe the scenario to the subject, e.g. ScenarioIdEnv.
+func (s Scenario) SubjectEnv() ([]string, error) {
+	axes, err := json.Marshal(s.AxisLabels())
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to encode axis labels of scenario [%s]", s.String())
+	}
+	return []string{
+		ScenarioIdEnv + "=" + strconv.Itoa(s.Id()),
+		AxesEnv + "=" + string(axes),
+		ResultFileEnv + "=" + s.ResultFile(),
+	}, nil
+}
+
+// readSubjectReport returns the report in the file, or nil if the subject did not write one.
+func readSubjectReport(name string) (*SubjectReport, error) {
+	content, err := ioutil.ReadFile(name) // #nosec G304
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "failed to read result file [%s]", name)
+	}
+
+	// Reject unknown fields so that typos in a wrapper script are not mistaken for an absent value.
+	var report SubjectReport
+	dec := json.NewDecoder(bytes.NewReader(content))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&report); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode result file [%s]", name)
+	}
+	return &report, nil
+}
@@ -6,13 +6,56 @@
 
 package gomodfuzz
 
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Result.Outcome classes
+const (
+	// PassOutcome means the command exited with code 0.
+	PassOutcome = iota
+
+	// ErrorOutcome means the command failed without a panic, e.g. with a non-zero exit code and a message.
+	ErrorOutcome
+
+	// PanicOutcome means the command's standard error, or its Transcript, contains a goroutine trace.
+	PanicOutcome
+
+	// TimeoutOutcome means the command did not finish before its context was done, e.g. because it hung.
+	TimeoutOutcome
+
+	// EnvErrorOutcome means `go env` failed, e.g. because of an invalid environment variable value,
+	// so the command did not run.
+	EnvErrorOutcome
+
+	// CheckFailOutcome means the command's Report is a failure, e.g. one of its checks failed.
+	CheckFailOutcome
+)
+
+// outcomeNames indexes the display names of Result.Outcome classes.
+var outcomeNames = map[int]string{
+	PassOutcome:      "pass",
+	ErrorOutcome:     "error",
+	PanicOutcome:     "panic",
+	TimeoutOutcome:   "timeout",
+	EnvErrorOutcome:  "env_error",
+	CheckFailOutcome: "check_fail",
+}
+
+// goroutineTrace matches the first line of each goroutine's stack in the output of an unrecovered panic.
+var goroutineTrace = regexp.MustCompile(`(?m)^goroutine \d+ \[[^\]]+\]:$`)
+
 // Result is the outcome of one execution of the input command in one Scenario.
 type Result struct {
 	// Scenario is a copy of the executed scenario spec.
 	Scenario Scenario
 
 	// Err is non-nil if the scenario's command fails to start, exits with a non-zero code,
-	// or its context times out.
+	// its context times out, or the result file it wrote cannot be decoded as a SubjectReport.
 	//
 	// It is also non-nil if `go env` fails before running the scenario's command.
 	Err error
@@ -20,17 +63,45 @@ type Result struct {
 	// Code is from the scenario's command.
 	//
 	// It is -1 if the command does not get an opporunity to run, e.g. if `go env` fails
-	// for some reason.
+	// for some reason, which is classified as EnvErrorOutcome.
 	Code int
 
 	// GoEnv is the output of `go env` prior to running the scenario.
 	GoEnv string
 
+	// GoMod is the GOMOD value in GoEnv, e.g. the path of the go.mod the go command found, "/dev/null"
+	// if module mode is enabled without one, or an empty string in GOPATH mode.
+	GoMod string
+
 	// Stderr is from the scenario's command.
 	Stderr string
 
 	// Stdout is from the scenario's command.
 	Stdout string
+
+	// DroppedEnv holds the sorted names of host environment variables which were not inherited because
+	// the scenario is hermetic.
+	DroppedEnv []string
+
+	// Transcript holds everything the command wrote to its pseudo-terminal, including standard error,
+	// if Scenario.TTY is PtyTty. Stdout and Stderr are then empty.
+	//
+	// Line endings are "\n" but other terminal output, e.g. color escape sequences, is preserved.
+	Transcript string
+
+	// Outcome classifies the result, e.g. PanicOutcome.
+	Outcome int
+
+	// ReadOnlyWrites holds the sorted paths, relative to the directory selected by Scenario.READ_ONLY,
+	// which the command created, removed, or modified.
+	//
+	// Only writes which succeeded are detected, by comparing snapshots of the tree before and after the
+	// command. They only succeed if permissions are not enforced, e.g. if the command runs as root.
+	// Otherwise the attempts fail, usually with an error from the command, and are absent here.
+	ReadOnlyWrites []string
+
+	// Report is the SubjectReport which the command wrote to Scenario.ResultFile, or nil if it wrote none.
+	Report *SubjectReport
 }
 
 // NewResult returns an initialized Result.
@@ -40,3 +111,56 @@ func NewResult(s Scenario) Result {
 		Scenario: s,
 	}
 }
+
+// OutcomeName returns the display name of a Result.Outcome class.
+func OutcomeName(outcome int) string {
+	if name, ok := outcomeNames[outcome]; ok {
+		return name
+	}
+	panic(errors.Errorf("invalid outcome [%d]", outcome))
+}
+
+// OutcomeNames returns the display names of all Result.Outcome classes, sorted by class.
+func OutcomeNames() (names []string) {
+	for outcome := 0; outcome < len(outcomeNames); outcome++ {
+		names = append(names, outcomeNames[outcome])
+	}
+	return names
+}
+
+// classify returns the Outcome class of the result of a command whose context error is the input.
+func (r Result) classify(ctxErr error) int {
+	switch {
+	case ctxErr != nil:
+		return TimeoutOutcome
+	case goroutineTrace.MatchString(r.Stderr), goroutineTrace.MatchString(r.Transcript):
+		return PanicOutcome
+	case r.Report != nil && r.Report.Failed():
+		return CheckFailOutcome
+	case r.Code == 0 && r.Err == nil:
+		return PassOutcome
+	default:
+		return ErrorOutcome
+	}
+}
+
+// goEnvValue returns a variable's value from `go env` output, or an empty string if it is absent.
+//
+// It supports the quoting of Unix shells and the "set NAME=VALUE" lines of Windows.
+func goEnvValue(goEnv, name string) string {
+	for _, line := range strings.Split(goEnv, "\n") {
+		line = strings.TrimPrefix(strings.TrimSpace(line), "set ")
+		if !strings.HasPrefix(line, name+"=") {
+			continue
+		}
+		value := strings.TrimPrefix(line, name+"=")
+		if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+			return value[1 : len(value)-1]
+		}
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			return unquoted
+		}
+		return value
+	}
+	return ""
+}
@@ -11,9 +11,14 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"text/template"
+	"unicode"
+
+	tp_algo "github.com/codeactual/gomodfuzz/internal/third_party/stackexchange/algo"
 
 	"github.com/pkg/errors"
 
@@ -36,25 +41,463 @@ const (
 	WdOutsideGopath
 )
 
+const (
+	// UnsetValue is the GO111MODULE and GOFLAGS value which removes the variable from the environment,
+	// rather than assigning an empty value.
+	UnsetValue = "<unset>"
+
+	// UnsetGopath is the Scenario.GOPATH selection mode which removes GOPATH from the environment.
+	//
+	// It follows the values of the other GOPATH and WD modes, which share one sequence.
+	UnsetGopath = WdOutsideGopath + 1
+)
+
+// Invalid environment variable values, which are assigned if Config.InvalidEnvAxes is true.
+const (
+	// InvalidGo111module is a GO111MODULE value other than "auto", "off", and "on".
+	InvalidGo111module = "yes"
+
+	// InvalidGoflags is a GOFLAGS value which contains an undefined flag.
+	InvalidGoflags = "-bogus"
+)
+
+// Invalid Scenario.GOPATH selection modes, which are assigned if Config.InvalidEnvAxes is true.
+//
+// They follow UnsetGopath in the sequence shared by the GOPATH and WD modes.
+const (
+	// RelativeGopath is the Scenario.GOPATH selection mode of a relative path.
+	RelativeGopath = UnsetGopath + 1 + iota
+
+	// GorootGopath is the Scenario.GOPATH selection mode of Config.Goroot, i.e. GOPATH equal to GOROOT.
+	GorootGopath
+
+	// FileGopath is the Scenario.GOPATH selection mode of a path to a regular file instead of a directory.
+	FileGopath
+)
+
+const (
+	// vcsMarkerFile is committed to the repository created by the VCS axis.
+	vcsMarkerFile = "gomodfuzz_vcs.txt"
+
+	// newerGoVersion is a Go version which is newer than any released toolchain.
+	newerGoVersion = "1.99"
+
+	// longPathLen is the minimum length of ScenarioDir in LongPathShape. It leaves room below Linux's
+	// PATH_MAX (4096) for descendants such as GOPATH/src/<import path> and module cache files.
+	longPathLen = 3584
+
+	// longPathSegment is repeated to lengthen ScenarioDir in LongPathShape. It is shorter than NAME_MAX (255).
+	longPathSegment = "long_path_segment_0123456789_0123456789_0123456789_0123456789_0123456789"
+
+	// nestedModuleDir is the path of the NESTED_MODULE axis's module relative to ModuleRoot.
+	nestedModuleDir = "sub"
+
+	// localDepDir is the path of the MOD_DIRECTIVE axis's local module relative to ModuleRoot.
+	localDepDir = "../dep"
+
+	// retractedVersion is the main module version retracted by RetractModDirective.
+	retractedVersion = "v0.1.0"
+
+	// majorVersionSuffix is the module path suffix, and major subdirectory, of the MAJOR_VERSION axis.
+	majorVersionSuffix = "v2"
+
+	// wrongGosumHash is a well-formed "h1:" hash which matches no fixture module, i.e. the hash of no files.
+	wrongGosumHash = "h1:47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="
+
+	// invalidGoVersion is the go directive version written by InvalidGoMalformedGomod.
+	invalidGoVersion = "1.x"
+
+	// duplicateRequirePath is the module path required twice by DuplicateRequireMalformedGomod.
+	duplicateRequirePath = "example.com/gomodfuzz/dup"
+)
+
+// Scenario.GOENV selection modes
+const (
+	// EmptyGoenv leaves the scenario's isolated GOENV file absent.
+	EmptyGoenv = iota
+
+	// WrittenGoenv writes Config.GoenvSettings into the scenario's isolated GOENV file.
+	WrittenGoenv
+)
+
+// Scenario.MODCACHE selection modes
+const (
+	// EmptyModcache starts the scenario with an empty GOMODCACHE.
+	EmptyModcache = iota
+
+	// SeededModcache starts the scenario with Config.FixtureModules already downloaded into GOMODCACHE.
+	SeededModcache
+
+	// ReadOnlyModcache is SeededModcache except all GOMODCACHE directories are read-only.
+	ReadOnlyModcache
+)
+
+// Scenario.GOPROXY selection modes
+const (
+	// OffGoproxy disallows module downloads with "GOPROXY=off".
+	OffGoproxy = iota
+
+	// DirectGoproxy downloads modules from their origins with "GOPROXY=direct".
+	DirectGoproxy
+
+	// FileGoproxy downloads Config.FixtureModules from a "file://" GOPROXY at Scenario.FileProxyDir.
+	FileGoproxy
+
+	// HTTPGoproxy downloads Config.FixtureModules from the ProxyServer at Config.ProxyURL, which injects
+	// the fault selected by Scenario.PROXY_FAULT.
+	HTTPGoproxy
+
+	// UnsetGoproxy removes GOPROXY from the environment.
+	UnsetGoproxy
+)
+
+// Scenario.PROXY_FAULT selection modes
+const (
+	// NoProxyFault serves the requested file as-is.
+	NoProxyFault = iota
+
+	// NotFoundProxyFault responds to all requests with 404 Not Found.
+	NotFoundProxyFault
+
+	// GoneProxyFault responds to all requests with 410 Gone.
+	GoneProxyFault
+
+	// SlowProxyFault delays all responses past the scenario timeout.
+	SlowProxyFault
+
+	// TruncatedZipProxyFault serves only the first half of module zip files.
+	TruncatedZipProxyFault
+
+	// CorruptZipProxyFault serves module zip files with a range of bytes inverted.
+	CorruptZipProxyFault
+
+	// SumMismatchProxyFault serves valid module zip files whose contents do not match the go.sum hashes.
+	SumMismatchProxyFault
+)
+
+// Scenario.PRIVATE selection modes
+const (
+	// PublicModules leaves GOPRIVATE, GONOSUMDB, and GOINSECURE empty.
+	PublicModules = iota
+
+	// GoprivateModules lists the fixture module paths in GOPRIVATE.
+	GoprivateModules
+
+	// GonosumdbModules lists the fixture module paths in GONOSUMDB.
+	GonosumdbModules
+
+	// GoinsecureModules lists the fixture module paths in GOINSECURE.
+	GoinsecureModules
+
+	// UnsetPrivateModules removes GOPRIVATE, GONOSUMDB, and GOINSECURE from the environment.
+	UnsetPrivateModules
+)
+
+// Scenario.VCS selection modes
+const (
+	// NoVcs leaves the scenario file tree outside of any repository.
+	NoVcs = iota
+
+	// CleanVcs makes the working directory the root of a git repository with all files committed.
+	CleanVcs
+
+	// DirtyVcs is CleanVcs except a committed file is then modified.
+	DirtyVcs
+
+	// SubdirVcs is CleanVcs except the repository root is the parent of the working directory.
+	SubdirVcs
+
+	// UnsafeVcs is CleanVcs except git treats the repository as owned by another user, which it refuses
+	// to use unless the directory is listed in safe.directory.
+	UnsafeVcs
+)
+
+// Scenario.GO_DIRECTIVE selection modes
+const (
+	// NoGoDirective omits the go directive from go.mod.
+	NoGoDirective = iota
+
+	// Go111GoDirective declares "go 1.11", the first version with module support.
+	Go111GoDirective
+
+	// Go114GoDirective declares "go 1.14", the first version which enables -mod=vendor by default if vendor/modules.txt exists.
+	Go114GoDirective
+
+	// Go117GoDirective declares "go 1.17", the first version with module graph pruning and lazy loading.
+	Go117GoDirective
+
+	// Go121GoDirective declares "go 1.21", the first version which treats the directive as a minimum requirement.
+	Go121GoDirective
+
+	// NewerGoDirective declares a version newer than any released toolchain.
+	NewerGoDirective
+)
+
+// Scenario.TOOLCHAIN selection modes
+const (
+	// NoToolchain omits the toolchain line from go.mod and sets "GOTOOLCHAIN=auto".
+	NoToolchain = iota
+
+	// NewerToolchain declares a toolchain newer than any released version and sets "GOTOOLCHAIN=auto",
+	// which allows the go command to try switching to it.
+	NewerToolchain
+
+	// NewerLocalToolchain is NewerToolchain except "GOTOOLCHAIN=local" prevents switching.
+	NewerLocalToolchain
+)
+
+// Scenario.PATH_SHAPE selection modes
+const (
+	// PlainPathShape uses ASCII paths without spaces or symlinks.
+	PlainPathShape = iota
+
+	// SpacesPathShape places the scenario's file tree in a directory whose name contains spaces.
+	SpacesPathShape
+
+	// UnicodePathShape places the scenario's file tree in a directory whose name contains non-ASCII characters.
+	UnicodePathShape
+
+	// SymlinkWdPathShape makes the working directory a symlink, so os.Getwd and filepath.EvalSymlinks disagree.
+	SymlinkWdPathShape
+
+	// SymlinkGopathPathShape makes the GOPATH value a symlink, so the resolved working directory is not
+	// lexically inside it.
+	SymlinkGopathPathShape
+
+	// LongPathShape places the scenario's file tree in a directory whose path is close to Linux's PATH_MAX.
+	LongPathShape
+)
+
+// Scenario.NESTED_MODULE selection modes
+const (
+	// NoNestedModule creates no module within ModuleRoot's module.
+	NoNestedModule = iota
+
+	// InsideNestedModule runs the command from a module nested in ModuleRoot's module.
+	InsideNestedModule
+
+	// ParentNestedModule runs the command from ModuleRoot, whose module contains a nested module.
+	ParentNestedModule
+
+	// ReplacedNestedModule is InsideNestedModule except ModuleRoot's module requires the nested module
+	// through a "replace ./sub" directive.
+	ReplacedNestedModule
+)
+
+// Scenario.MOD_DIRECTIVE selection modes
+const (
+	// NoModDirective adds no replace, exclude, or retract directives to go.mod.
+	NoModDirective = iota
+
+	// ReplaceRelativeModDirective requires a local module and replaces it with "=> ../dep".
+	ReplaceRelativeModDirective
+
+	// ReplaceAbsoluteModDirective requires a local module and replaces it with its absolute path.
+	ReplaceAbsoluteModDirective
+
+	// ReplaceVersionModDirective replaces the required version of a fixture module with another of its versions.
+	ReplaceVersionModDirective
+
+	// ExcludeModDirective excludes the required version of a fixture module.
+	ExcludeModDirective
+
+	// RetractModDirective retracts a version of the main module.
+	RetractModDirective
+)
+
+// Scenario.MAJOR_VERSION selection modes
+const (
+	// NoMajorVersion declares a module path without a major version suffix.
+	NoMajorVersion = iota
+
+	// SubdirMajorVersion declares a "/v2" module in the "v2" subdirectory of a module without the suffix,
+	// i.e. the major subdirectory layout.
+	SubdirMajorVersion
+
+	// BranchMajorVersion declares a "/v2" module in the directory which would otherwise contain the module
+	// without the suffix, i.e. the major branch layout.
+	BranchMajorVersion
+
+	// DepMajorVersion declares a module path without a major version suffix which imports a "/vN" fixture module.
+	DepMajorVersion
+)
+
+// Scenario.GOSUM selection modes
+const (
+	// NoGosum creates no go.sum.
+	NoGosum = iota
+
+	// CompleteGosum creates a go.sum which contains the genuine hashes of the required fixture modules.
+	CompleteGosum
+
+	// MissingEntryGosum is CompleteGosum except the "/go.mod" hash of the first required module is absent.
+	MissingEntryGosum
+
+	// WrongHashGosum is CompleteGosum except the "/go.mod" hash of the first required module is wrong.
+	WrongHashGosum
+)
+
+// Scenario.MALFORMED_GOMOD selection modes
+const (
+	// NoMalformedGomod creates a valid go.mod.
+	NoMalformedGomod = iota
+
+	// SyntaxMalformedGomod ends go.mod with an unterminated require block.
+	SyntaxMalformedGomod
+
+	// NoModuleMalformedGomod omits the module directive.
+	NoModuleMalformedGomod
+
+	// UnknownDirectiveMalformedGomod adds a directive which the go command does not define.
+	UnknownDirectiveMalformedGomod
+
+	// DuplicateRequireMalformedGomod requires two versions of the same module in separate directives.
+	DuplicateRequireMalformedGomod
+
+	// InvalidGoMalformedGomod declares a go directive version which does not match the version format.
+	InvalidGoMalformedGomod
+)
+
+// Scenario.PLATFORM selection modes
+const (
+	// HostPlatform inherits GOOS and GOARCH.
+	HostPlatform = iota
+
+	// LinuxAmd64Platform assigns GOOS=linux and GOARCH=amd64.
+	LinuxAmd64Platform
+
+	// WindowsAmd64Platform assigns GOOS=windows and GOARCH=amd64.
+	WindowsAmd64Platform
+
+	// DarwinArm64Platform assigns GOOS=darwin and GOARCH=arm64.
+	DarwinArm64Platform
+)
+
+// Scenario.CGO selection modes
+const (
+	// InheritedCgo inherits CGO_ENABLED.
+	InheritedCgo = iota
+
+	// EnabledCgo assigns CGO_ENABLED=1.
+	EnabledCgo
+
+	// DisabledCgo assigns CGO_ENABLED=0.
+	DisabledCgo
+)
+
+// Scenario.READ_ONLY selection modes
+const (
+	// NoReadOnly leaves all scenario directories writable.
+	NoReadOnly = iota
+
+	// WdReadOnly removes write permission from the working directory tree.
+	WdReadOnly
+
+	// ModuleRootReadOnly removes write permission from the module root tree, which contains the working directory.
+	ModuleRootReadOnly
+
+	// GopathReadOnly removes write permission from the GOPATH tree. It has no effect if GOPATH is not
+	// a scenario directory, e.g. if it is empty.
+	GopathReadOnly
+
+	// ModcacheReadOnly removes write permission from the GOMODCACHE tree, including its download cache.
+	// It has no effect if the MODCACHE axis is not enabled.
+	ModcacheReadOnly
+)
+
+// Scenario.TTY selection modes
+const (
+	// PipeTty connects the command's standard out/error to pipes and its standard in to the null device.
+	PipeTty = iota
+
+	// PtyTty connects the command's standard in/out/error to a pseudo-terminal, e.g. so it enables colors,
+	// progress bars, or prompts.
+	PtyTty
+)
+
+// Scenario.PATTERN selection modes
+const (
+	// DotPattern names the working directory's package as ".".
+	DotPattern = iota
+
+	// DotRecursivePattern names the working directory's package, and those below it, as "./...".
+	DotRecursivePattern
+
+	// ImportPathPattern names the working directory's package by its import path in the module which
+	// contains it, e.g. "<module path>/testdata".
+	ImportPathPattern
+
+	// AbsDirPattern names the working directory's package by its absolute path.
+	AbsDirPattern
+
+	// RelDirPattern names the working directory's package by its path relative to itself through its parent,
+	// e.g. "../wd".
+	RelDirPattern
+)
+
+// Scenario.SPECIAL_DIR selection modes
+const (
+	// NoSpecialDir runs the command from the module root.
+	NoSpecialDir = iota
+
+	// PackageSpecialDir runs the command from an ordinary package directory in the module, "pkg".
+	PackageSpecialDir
+
+	// TestdataSpecialDir runs the command from the "testdata" directory, which the go command ignores.
+	TestdataSpecialDir
+
+	// UnderscoreSpecialDir runs the command from the "_x" directory, which the go command ignores.
+	UnderscoreSpecialDir
+
+	// DotSpecialDir runs the command from the ".x" directory, which the go command ignores.
+	DotSpecialDir
+
+	// VendorSpecialDir runs the command from the "vendor" directory, which the go command treats specially.
+	VendorSpecialDir
+)
+
+// Scenario.LAYOUT selection modes
+const (
+	// FlatLayout selects the working directory based on Scenario.WD and declares the module path "wd".
+	FlatLayout = iota
+
+	// GopathSrcLayout places the working directory at GOPATH/src/<import path> and declares the
+	// import path as the module path.
+	GopathSrcLayout
+
+	// GopathSrcMismatchLayout is GopathSrcLayout except the module path does not match the import path.
+	GopathSrcMismatchLayout
+
+	// ShadowedLayout places the working directory outside GOPATH, declares the import path as the module
+	// path, and also creates a package at GOPATH/src/<import path> which may shadow the module's.
+	ShadowedLayout
+)
+
 // Scenario defines how a command should be executed in a scenario.
 type Scenario struct {
 	// GO111MODULE is the environment variable value applied to the scenario.
 	//
 	// It is assigned a value by a permutation generator. The generator assigns one of
-	// three values: "auto", "off", "on".
+	// three values: "auto", "off", "on". If Config.UnsetEnvAxes is true, it also assigns UnsetValue.
+	// If Config.InvalidEnvAxes is true, it also assigns InvalidGo111module.
 	GO111MODULE string
 
 	// GOFLAGS is the environment variable value applied to the scenario.
 	//
 	// It is assigned a value by a permutation generator. The generator assigns one of
-	// two values: empty string or "-mod=vendor".
+	// two values: empty string or "-mod=vendor". If Config.Goflags is non-empty, it instead assigns
+	// the values composed from them by ComposeGoflags. If Config.BuildvcsFalse is true, it also assigns
+	// each with "-buildvcs=false" added. If Config.UnsetEnvAxes is true, it also assigns UnsetValue.
+	// If Config.InvalidEnvAxes is true, it also assigns InvalidGoflags.
 	GOFLAGS string
 
 	// GOPATH is a mode of selecting environment variable value applied to the scenario.
 	//
 	// It is assigned a value by a permutation generator. The generator assigns one of three modes
 	// which select these path types: a path which may contain the working directory as a descendant,
-	// a path which never contains the working directory, and an empty string.
+	// a path which never contains the working directory, and an empty string. If Config.UnsetEnvAxes is true,
+	// it also assigns UnsetGopath. If Config.InvalidEnvAxes is true, it also assigns RelativeGopath, GorootGopath,
+	// and FileGopath.
 	GOPATH int
 
 	// IN_MODULE is true if the command should in a working directory with a go.mod.
@@ -69,6 +512,143 @@ type Scenario struct {
 	// "<Scenario.rootDir>/<scenario dir>/gopath/wd".
 	WD int
 
+	// LAYOUT is a mode of arranging the working directory relative to GOPATH/src and the module path.
+	//
+	// It is assigned a value by a permutation generator if Config.Layouts is non-empty. Its zero value,
+	// FlatLayout, preserves the WD-based working directory selection. Permute omits the other layouts
+	// unless GOPATH is UsableGopath and WD matches the layout's working directory.
+	LAYOUT int
+
+	// GOENV is a mode of populating the scenario's isolated GOENV file, which stores `go env -w` settings.
+	//
+	// It is assigned a value by a permutation generator if Config.Goenvs is non-empty. Its zero value,
+	// EmptyGoenv, leaves the file absent.
+	GOENV int
+
+	// MODCACHE is a mode of preparing the scenario's GOMODCACHE.
+	//
+	// It is assigned a value by a permutation generator if Config.Modcaches is non-empty. If Config.Modcaches
+	// is empty, GOMODCACHE is not set and the go command selects it, e.g. under GOPATH.
+	MODCACHE int
+
+	// GOPROXY is a mode of selecting the environment variable value applied to the scenario.
+	//
+	// It is assigned a value by a permutation generator if Config.Goproxies is non-empty. If Config.Goproxies
+	// is empty, GOPROXY is inherited.
+	GOPROXY int
+
+	// PRIVATE is a mode of selecting which of GOPRIVATE, GONOSUMDB, and GOINSECURE lists the fixture module paths.
+	//
+	// It is assigned a value by a permutation generator if Config.Privates is non-empty. If Config.Privates
+	// is empty, all three are inherited.
+	PRIVATE int
+
+	// PROXY_FAULT is a mode of injecting faults into responses from the ProxyServer used by HTTPGoproxy.
+	//
+	// It is assigned a value by a permutation generator if Config.ProxyFaults is non-empty. Its zero value,
+	// NoProxyFault, serves responses as-is. If it is enabled, and GOSUM is not, the go.sum created in the working
+	// directory contains the genuine hashes of required fixture modules, so tampered downloads can be detected.
+	PROXY_FAULT int
+
+	// VCS is a mode of initializing a git repository which contains the working directory.
+	//
+	// It is assigned a value by a permutation generator if Config.Vcses is non-empty. Its zero value,
+	// NoVcs, does not create a repository.
+	VCS int
+
+	// GO_DIRECTIVE is a mode of selecting the go directive in the go.mod created in the working directory.
+	//
+	// It is assigned a value by a permutation generator if Config.GoDirectives is non-empty. Its zero value,
+	// NoGoDirective, omits the directive.
+	GO_DIRECTIVE int
+
+	// TOOLCHAIN is a mode of selecting the toolchain line in the go.mod created in the working directory,
+	// and the GOTOOLCHAIN environment variable value.
+	//
+	// It is assigned a value by a permutation generator if Config.Toolchains is non-empty. If Config.Toolchains
+	// is empty, the toolchain line is omitted and GOTOOLCHAIN is inherited.
+	TOOLCHAIN int
+
+	// PATH_SHAPE is a mode of shaping the paths of the scenario's file tree, GOPATH, and working directory.
+	//
+	// It is assigned a value by a permutation generator if Config.PathShapes is non-empty. Its zero value,
+	// PlainPathShape, preserves the default paths.
+	PATH_SHAPE int
+
+	// SPECIAL_DIR is a mode of selecting a directory within the module, e.g. "testdata", from which the command runs.
+	//
+	// It is assigned a value by a permutation generator if Config.SpecialDirs is non-empty. Its zero value,
+	// NoSpecialDir, runs the command from the module root.
+	SPECIAL_DIR int
+
+	// NESTED_MODULE is a mode of creating a module nested in the working directory's module, e.g. to run
+	// the command from inside it.
+	//
+	// It is assigned a value by a permutation generator if Config.NestedModules is non-empty. Its zero value,
+	// NoNestedModule, creates only one module.
+	NESTED_MODULE int
+
+	// MOD_DIRECTIVE is a mode of adding replace, exclude, or retract directives to the go.mod created if
+	// IN_MODULE is true.
+	//
+	// It is assigned a value by a permutation generator if Config.ModDirectives is non-empty. Its zero value,
+	// NoModDirective, adds none.
+	MOD_DIRECTIVE int
+
+	// MAJOR_VERSION is a mode of using "/vN" major version suffixes in module paths, e.g. to declare
+	// the working directory's module as "<path>/v2".
+	//
+	// It is assigned a value by a permutation generator if Config.MajorVersions is non-empty. Its zero value,
+	// NoMajorVersion, uses no suffixes.
+	MAJOR_VERSION int
+
+	// GOSUM is a mode of creating the go.sum of the module created if IN_MODULE is true, e.g. with a missing entry.
+	//
+	// It is assigned a value by a permutation generator if Config.Gosums is non-empty. If Config.Gosums is empty,
+	// the go.sum is complete if Config.ProxyFaults is non-empty, and absent otherwise.
+	GOSUM int
+
+	// MALFORMED_GOMOD is a mode of breaking the go.mod created if IN_MODULE is true, e.g. with a syntax error.
+	//
+	// It is assigned a value by a permutation generator if Config.MalformedGomods is non-empty. Its zero value,
+	// NoMalformedGomod, creates a valid go.mod.
+	MALFORMED_GOMOD int
+
+	// PLATFORM is a mode of selecting the GOOS and GOARCH values, e.g. to cross-compile for Windows.
+	//
+	// It is assigned a value by a permutation generator if Config.Platforms is non-empty. Its zero value,
+	// HostPlatform, inherits both variables.
+	PLATFORM int
+
+	// CGO is a mode of selecting the CGO_ENABLED value.
+	//
+	// It is assigned a value by a permutation generator if Config.Cgos is non-empty. Its zero value,
+	// InheritedCgo, inherits the variable.
+	CGO int
+
+	// READ_ONLY is a mode of removing write permission from a scenario directory, e.g. the working directory,
+	// before the command runs.
+	//
+	// It is assigned a value by a permutation generator if Config.ReadOnlys is non-empty. Its zero value,
+	// NoReadOnly, leaves all directories writable.
+	READ_ONLY int
+
+	// TTY is a mode of connecting the command's standard in/out/error, e.g. to a pseudo-terminal.
+	//
+	// It is assigned a value by a permutation generator if Config.Ttys is non-empty. Its zero value,
+	// PipeTty, uses pipes.
+	TTY int
+
+	// PATTERN is a mode of naming the working directory's package, e.g. by its import path, in place of
+	// PatternPlaceholder in the command's arguments.
+	//
+	// It is assigned a value by a permutation generator if Config.Patterns is non-empty. If Config.Patterns
+	// is empty, the arguments are not modified.
+	PATTERN int
+
+	// config selects the optional axes and holds settings they share.
+	config Config
+
 	// executor implementations run os/exec commands, allowing tests to mock their execution.
 	executor cage_exec.Executor
 
@@ -76,6 +656,9 @@ type Scenario struct {
 	// The command's working directory, and GOPATH (if enabled), will be under this root directory.
 	rootDir string
 
+	// hostEnviron replaces os.Environ as the host environment if non-nil.
+	hostEnviron []string
+
 	// permuteId is assigned the current value of nextPermuteId when the Wd value is generated in PermuteValues.
 	//
 	// It is used to generate unique Wd values.
@@ -83,45 +666,516 @@ type Scenario struct {
 }
 
 // NewScenario returns an initialized value.
-func NewScenario(executor cage_exec.Executor, rootDir string) Scenario {
-	return Scenario{executor: executor, rootDir: rootDir}
+//
+// An optional Config will replace the default (zero) value.
+func NewScenario(executor cage_exec.Executor, rootDir string, cfgs ...Config) Scenario {
+	var config Config
+	if len(cfgs) >= 1 {
+		config = cfgs[0]
+	}
+	return Scenario{executor: executor, rootDir: rootDir, config: config}
 }
 
 // BeforeRun sets up the environment in preparation for Run.
 func (s Scenario) BeforeRun(stage *cage_file_stage.Stage) error {
+	// Create symlinks first so that files are written through them.
+	if err := s.preparePathShape(); err != nil {
+		return errors.Wrapf(err, "failed to prepare path shape in scenario [%s]", s.String())
+	}
+
 	// Create the go.mod file to simulate running the input command from a module's directory.
 	if s.IN_MODULE {
-		modFilePath := filepath.Join(s.Wd(), "go.mod")
-		relPath, pathErr := filepath.Rel(s.rootDir, modFilePath)
-		if pathErr != nil {
-			return errors.Wrapf(pathErr,
-				"failed to get relative path from [%s] to [%s]", s.rootDir, modFilePath,
+		if err := writeStageFile(stage, filepath.Join(s.ModuleRoot(), "go.mod"), s.goMod()); err != nil {
+			return errors.Wrapf(err,
+				"failed to create go.mod in scenario [%s] module root [%s]", s.String(), s.ModuleRoot(),
 			)
 		}
+	}
+
+	// Create the module without the major version suffix, which contains the major subdirectory.
+	if s.IN_MODULE && s.MAJOR_VERSION == SubdirMajorVersion {
+		unsuffixedGoMod := "module " + s.unsuffixedModulePath() + "\n"
+		if err := writeStageFile(stage, filepath.Join(filepath.Dir(s.ModuleRoot()), "go.mod"), unsuffixedGoMod); err != nil {
+			return errors.Wrapf(err, "failed to create go.mod above major subdirectory in scenario [%s]", s.String())
+		}
+	}
+
+	if nestedDir := s.NestedModuleDir(); nestedDir != "" {
+		if s.IN_MODULE {
+			if err := writeStageFile(stage, filepath.Join(nestedDir, "go.mod"), s.nestedGoMod()); err != nil {
+				return errors.Wrapf(err, "failed to create nested go.mod in scenario [%s]", s.String())
+			}
+		}
+		if err := writeStageFile(stage, filepath.Join(nestedDir, nestedModuleDir+".go"), "package "+nestedModuleDir+"\n"); err != nil {
+			return errors.Wrapf(err, "failed to create nested module package in scenario [%s]", s.String())
+		}
+	}
+
+	relPath, pathErr := filepath.Rel(stage.Path(), s.Wd())
+	if pathErr != nil {
+		return errors.Wrapf(pathErr,
+			"failed to get relative path from [%s] to [%s]", stage.Path(), s.Wd(),
+		)
+	}
+
+	if mkdirErr := stage.MkdirAll(relPath, newDirPerm); mkdirErr != nil {
+		return errors.Wrapf(mkdirErr, "failed to create scenario [%s] working directory [%s]", s.String(), s.Wd())
+	}
+
+	if s.SPECIAL_DIR != NoSpecialDir {
+		// Give the special directory a package so that the go command has a reason to load it.
+		if err := writeStageFile(stage, filepath.Join(s.Wd(), "special.go"), "package special\n"); err != nil {
+			return errors.Wrapf(err, "failed to create package in scenario [%s] working directory [%s]", s.String(), s.Wd())
+		}
+	}
+
+	// Create the local module which replace directives refer to.
+	if s.MOD_DIRECTIVE == ReplaceRelativeModDirective || s.MOD_DIRECTIVE == ReplaceAbsoluteModDirective {
+		files := map[string]string{
+			"go.mod": "module " + s.LocalDepModulePath() + "\n",
+			"dep.go": "package dep\n",
+		}
+		for name, content := range files {
+			if err := writeStageFile(stage, filepath.Join(s.LocalDepDir(), name), content); err != nil {
+				return errors.Wrapf(err, "failed to create local module in scenario [%s]", s.String())
+			}
+		}
+	}
+
+	// Create the alternate go.mod selected by "-modfile" with the same content as the one it replaces.
+	modfile := s.Modfile()
+	if s.IN_MODULE && modfile != "" {
+		content := s.goMod()
+		if s.nestedWdDir() != "" {
+			content = s.nestedGoMod()
+		}
+		if err := writeStageFile(stage, modfile, content); err != nil {
+			return errors.Wrapf(err, "failed to create -modfile [%s] in scenario [%s]", modfile, s.String())
+		}
+	}
+
+	if s.IN_MODULE && s.gosumState() != NoGosum {
+		goSum, err := s.goSum()
+		if err != nil {
+			return errors.Wrapf(err, "failed to generate go.sum in scenario [%s]", s.String())
+		}
+		sumNames := []string{filepath.Join(s.ModuleRoot(), "go.sum")}
+		if modfile != "" {
+			sumNames = append(sumNames, strings.TrimSuffix(modfile, ".mod")+".sum")
+		}
+		for _, sumName := range sumNames {
+			if err := writeStageFile(stage, sumName, goSum); err != nil {
+				return errors.Wrapf(err, "failed to create [%s] in scenario [%s]", sumName, s.String())
+			}
+		}
+	}
+
+	if s.GOPATH == FileGopath {
+		if err := writeStageFile(stage, s.Gopath(), "GOPATH is a regular file\n"); err != nil {
+			return errors.Wrapf(err, "failed to create GOPATH file in scenario [%s]", s.String())
+		}
+	}
+
+	// Create the isolated HOME, and optionally persisted `go env -w` settings.
+
+	relHome, pathErr := filepath.Rel(stage.Path(), s.Home())
+	if pathErr != nil {
+		return errors.Wrapf(pathErr, "failed to get relative path from [%s] to [%s]", stage.Path(), s.Home())
+	}
+	if mkdirErr := stage.MkdirAll(relHome, newDirPerm); mkdirErr != nil {
+		return errors.Wrapf(mkdirErr, "failed to create HOME in scenario [%s]", s.String())
+	}
+
+	if s.GOENV == WrittenGoenv {
+		if err := writeStageFile(stage, s.Goenv(), strings.Join(s.config.GoenvSettings, "\n")+"\n"); err != nil {
+			return errors.Wrapf(err, "failed to create GOENV file in scenario [%s]", s.String())
+		}
+	}
+
+	if gomodcache := s.Gomodcache(); gomodcache != "" {
+		if err := s.prepareModcache(gomodcache); err != nil {
+			return errors.Wrapf(err, "failed to prepare GOMODCACHE in scenario [%s]", s.String())
+		}
+	}
+
+	if s.LAYOUT != FlatLayout {
+		// Give the working directory a package which can be resolved by import path. Each copy of the package
+		// identifies itself so the subject's output can reveal which one was loaded.
+
+		if err := writeStageFile(stage, s.packageFile(s.ModuleRoot()), s.packageSource("wd")); err != nil {
+			return errors.Wrapf(err, "failed to create package in scenario [%s] module root [%s]", s.String(), s.ModuleRoot())
+		}
+
+		if s.LAYOUT == ShadowedLayout {
+			shadowDir := s.gopathSrcDir()
+			if err := writeStageFile(stage, s.packageFile(shadowDir), s.packageSource("gopath")); err != nil {
+				return errors.Wrapf(err, "failed to create shadow package in scenario [%s] GOPATH [%s]", s.String(), shadowDir)
+			}
+		}
+	}
+
+	if len(s.config.Platforms) > 0 || len(s.config.Cgos) > 0 {
+		for name, content := range s.platformFiles() {
+			if err := writeStageFile(stage, filepath.Join(s.ModuleRoot(), name), content); err != nil {
+				return errors.Wrapf(err, "failed to create platform package file [%s] in scenario [%s]", name, s.String())
+			}
+		}
+	}
+
+	if s.MAJOR_VERSION != NoMajorVersion {
+		// Give the module a package so the subject has an import path, which includes any suffix, to compute.
+		if err := writeStageFile(stage, filepath.Join(s.ModuleRoot(), "major.go"), s.majorSource()); err != nil {
+			return errors.Wrapf(err, "failed to create package in scenario [%s] module root [%s]", s.String(), s.ModuleRoot())
+		}
+	}
+
+	// Initialize the repository last so it can commit all other working directory files.
+	if s.VCS != NoVcs {
+		if err := s.prepareVcs(stage); err != nil {
+			return errors.Wrapf(err, "failed to prepare git repository in scenario [%s]", s.String())
+		}
+	}
+
+	// Remove write permission after all files are created, including those in the selected directory.
+	if err := s.prepareReadOnly(); err != nil {
+		return errors.Wrapf(err, "failed to make directory read-only in scenario [%s]", s.String())
+	}
+
+	return nil
+}
+
+// prepareVcs creates the git repository in the state selected by VCS.
+func (s Scenario) prepareVcs(stage *cage_file_stage.Stage) error {
+	root := s.VcsRoot()
+	marker := filepath.Join(s.ModuleRoot(), vcsMarkerFile)
+
+	// Ensure there is a tracked file to modify in DirtyVcs, even if the working directory is otherwise empty.
+	if err := writeStageFile(stage, marker, "committed\n"); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := s.git(root, "init", "-q"); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if s.VCS == SubdirVcs {
+		// The parent directory may also contain other scenario files, e.g. HOME, which should neither be
+		// committed nor make the repository dirty.
+		exclude := "/*\n!/" + filepath.Base(s.ModuleRoot()) + "/\n"
+		if err := writeStageFile(stage, filepath.Join(root, ".git", "info", "exclude"), exclude); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	if err := s.git(root, "add", "-A"); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := s.git(root, "-c", "user.name=gomodfuzz", "-c", "user.email=gomodfuzz@example.com", "commit", "-q", "-m", "gomodfuzz scenario"); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if s.VCS == DirtyVcs {
+		return errors.WithStack(writeStageFile(stage, marker, "modified\n"))
+	}
+
+	return nil
+}
+
+// git runs a git command in the input directory with the scenario's isolated HOME, so the invoking user's
+// git config cannot affect the repository, e.g. by listing it in safe.directory.
+func (s Scenario) git(dir string, args ...string) error {
+	cmd := s.executor.Command("git", args...)
+	cmd.Dir = dir
+	hostEnv, _ := s.hostEnv()
+	env := NewEnv(hostEnv)
+	env.Set("HOME", s.Home())
+	env.Set("XDG_CONFIG_HOME", s.XdgConfigHome())
+	env.Set("GIT_CONFIG_NOSYSTEM", "1")
+	cmd.Env = env.Environ()
+
+	_, stderr, _, err := s.executor.Buffered(context.Background(), cmd)
+	if err != nil {
+		return errors.Wrapf(err, "failed to run [git %s] in [%s]: %s", strings.Join(args, " "), dir, strings.TrimSpace(stderr.String()))
+	}
+
+	return nil
+}
+
+// preparePathShape creates the symlinks selected by PATH_SHAPE.
+func (s Scenario) preparePathShape() error {
+	var links map[string]string // symlink targets indexed by symlink path
+
+	switch s.PATH_SHAPE {
+	case SymlinkWdPathShape:
+		links = map[string]string{s.ModuleRoot(): s.realModuleRoot()}
+	case SymlinkGopathPathShape:
+		if s.GOPATH == UsableGopath || s.GOPATH == UnusedGopath {
+			links = map[string]string{s.Gopath(): s.realGopath()}
+		}
+	}
+
+	for link, target := range links {
+		for _, dir := range []string{target, filepath.Dir(link)} {
+			if err := os.MkdirAll(dir, newDirPerm); err != nil {
+				return errors.Wrapf(err, "failed to make directory [%s]", dir)
+			}
+		}
+		if err := os.Symlink(target, link); err != nil {
+			return errors.Wrapf(err, "failed to create symlink [%s] to [%s]", link, target)
+		}
+	}
+
+	return nil
+}
+
+// prepareModcache creates the GOMODCACHE directory in the state selected by MODCACHE.
+func (s Scenario) prepareModcache(dir string) error {
+	if err := os.MkdirAll(dir, newDirPerm); err != nil {
+		return errors.Wrapf(err, "failed to make directory [%s]", dir)
+	}
+
+	switch s.MODCACHE {
+	case EmptyModcache:
+		return nil
+	case SeededModcache, ReadOnlyModcache:
+		if err := WriteModuleCache(s.config.FixtureModules, dir); err != nil {
+			return errors.WithStack(err)
+		}
+	default:
+		panic(errors.Errorf("scenario generator used an invalid MODCACHE mode [%d]", s.MODCACHE))
+	}
+
+	if s.MODCACHE == ReadOnlyModcache {
+		return errors.WithStack(chmodDirs(dir, modcacheDirPerm))
+	}
+
+	return nil
+}
+
+// goMod returns the content of the go.mod file created in the working directory.
+func (s Scenario) goMod() string {
+	var b strings.Builder
+
+	if s.MALFORMED_GOMOD != NoModuleMalformedGomod {
+		b.WriteString("module " + s.ModulePath() + "\n")
+	}
+
+	version := s.GoDirective()
+	if s.MALFORMED_GOMOD == InvalidGoMalformedGomod {
+		version = invalidGoVersion
+	}
+	if version != "" {
+		b.WriteString("\ngo " + version + "\n")
+	}
+	if s.TOOLCHAIN != NoToolchain {
+		b.WriteString("\ntoolchain go" + newerGoVersion + ".0\n")
+	}
+
+	requires := s.requiredModules()
+	if s.NESTED_MODULE == ReplacedNestedModule {
+		requires = append(requires, FixtureModule{Path: s.NestedModulePath(), Version: "v0.0.0"})
+	}
+	if s.MOD_DIRECTIVE == ReplaceRelativeModDirective || s.MOD_DIRECTIVE == ReplaceAbsoluteModDirective {
+		requires = append(requires, FixtureModule{Path: s.LocalDepModulePath(), Version: "v0.0.0"})
+	}
+	if len(requires) > 0 {
+		b.WriteString("\nrequire (\n")
+		for _, m := range requires {
+			b.WriteString("\t" + m.Path + " " + m.Version + "\n")
+		}
+		b.WriteString(")\n")
+	}
+
+	if s.NESTED_MODULE == ReplacedNestedModule {
+		b.WriteString("\nreplace " + s.NestedModulePath() + " => ./" + nestedModuleDir + "\n")
+	}
+
+	if directive := s.modDirective(); directive != "" {
+		b.WriteString("\n" + directive + "\n")
+	}
+
+	switch s.MALFORMED_GOMOD {
+	case SyntaxMalformedGomod:
+		b.WriteString("\nrequire (\n")
+	case UnknownDirectiveMalformedGomod:
+		b.WriteString("\nfrobnicate example.com/gomodfuzz/unknown v1.0.0\n")
+	case DuplicateRequireMalformedGomod:
+		b.WriteString("\nrequire " + duplicateRequirePath + " v1.0.0\n")
+		b.WriteString("\nrequire " + duplicateRequirePath + " v1.1.0\n")
+	}
+
+	return b.String()
+}
+
+// modDirective returns the go.mod directive selected by MOD_DIRECTIVE, or an empty string if none applies.
+//
+// ReplaceVersionModDirective and ExcludeModDirective apply only if a required fixture module has another version.
+func (s Scenario) modDirective() string {
+	switch s.MOD_DIRECTIVE {
+	case NoModDirective:
+		return ""
+	case ReplaceRelativeModDirective:
+		return "replace " + s.LocalDepModulePath() + " => " + localDepDir
+	case ReplaceAbsoluteModDirective:
+		return "replace " + s.LocalDepModulePath() + " => " + strconv.Quote(s.LocalDepDir())
+	case ReplaceVersionModDirective:
+		if required, other, ok := s.otherVersion(); ok {
+			return "replace " + required.Path + " " + required.Version + " => " + other.Path + " " + other.Version
+		}
+		return ""
+	case ExcludeModDirective:
+		if required, _, ok := s.otherVersion(); ok {
+			return "exclude " + required.Path + " " + required.Version
+		}
+		return ""
+	case RetractModDirective:
+		return "retract " + retractedVersion
+	default:
+		panic(errors.Errorf("scenario generator used an invalid MOD_DIRECTIVE mode [%d]", s.MOD_DIRECTIVE))
+	}
+}
+
+// otherVersion returns the first required fixture module which has another version, and that version.
+func (s Scenario) otherVersion() (required, other FixtureModule, ok bool) {
+	for _, required = range s.requiredModules() {
+		for _, other = range s.config.FixtureModules {
+			if other.Path == required.Path && other.Version != required.Version {
+				return required, other, true
+			}
+		}
+	}
+	return FixtureModule{}, FixtureModule{}, false
+}
+
+// LocalDepDir returns the directory of the local module required by ReplaceRelativeModDirective and
+// ReplaceAbsoluteModDirective. It is a sibling of ModuleRoot.
+func (s Scenario) LocalDepDir() string {
+	return filepath.Join(s.ModuleRoot(), filepath.FromSlash(localDepDir))
+}
+
+// LocalDepModulePath returns the module path of the module in LocalDepDir.
+//
+// It is a sibling of ImportPath so that GOPATH/src layouts also place it where GOPATH mode would resolve it.
+func (s Scenario) LocalDepModulePath() string {
+	return path.Join(path.Dir(s.config.importPath()), "dep")
+}
+
+// nestedGoMod returns the content of the nested module's go.mod file.
+func (s Scenario) nestedGoMod() string {
+	var b strings.Builder
+
+	b.WriteString("module " + s.NestedModulePath() + "\n")
+
+	if version := s.GoDirective(); version != "" {
+		b.WriteString("\ngo " + version + "\n")
+	}
+
+	return b.String()
+}
+
+// goSum returns the content of a go.sum file, in the state selected by gosumState, for the required fixture modules.
+//
+// The "/go.mod" hash is the one altered by MissingEntryGosum and WrongHashGosum because even commands which
+// load no packages, e.g. `go list -m all`, verify it.
+func (s Scenario) goSum() (string, error) {
+	var lines []string
+	for n, m := range s.requiredModules() {
+		zipHash, err := m.ZipHash()
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+		goModHash, err := m.GoModHash()
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+		lines = append(lines, fmt.Sprintf("%s %s %s\n", m.Path, m.Version, zipHash))
+
+		if n == 0 {
+			switch s.gosumState() {
+			case MissingEntryGosum:
+				continue
+			case WrongHashGosum:
+				goModHash = wrongGosumHash
+			}
+		}
+		lines = append(lines, fmt.Sprintf("%s %s/go.mod %s\n", m.Path, m.Version, goModHash))
+	}
+	return strings.Join(lines, ""), nil
+}
+
+// gosumState returns the GOSUM mode, or the mode implied by other axes if the GOSUM axis is disabled.
+func (s Scenario) gosumState() int {
+	if len(s.config.Gosums) > 0 {
+		return s.GOSUM
+	}
+	if len(s.config.ProxyFaults) > 0 {
+		return CompleteGosum
+	}
+	return NoGosum
+}
+
+// requiredModules returns the lowest version of each fixture module, which go.mod files require.
+func (s Scenario) requiredModules() (mods []FixtureModule) {
+	seen := map[string]bool{}
+	for _, m := range s.config.FixtureModules { // sorted by LoadFixtureModules
+		if !seen[m.Path] {
+			mods = append(mods, m)
+			seen[m.Path] = true
+		}
+	}
+	return mods
+}
+
+// fixturePatterns returns a GOPRIVATE-style list of the fixture module paths.
+func (s Scenario) fixturePatterns() string {
+	var paths []string
+	for _, m := range s.requiredModules() {
+		paths = append(paths, m.Path)
+	}
+	return strings.Join(paths, ",")
+}
+
+// packageName returns the name of the package created in the working directory, derived from the import path.
+func (s Scenario) packageName() string {
+	name := []rune(path.Base(s.config.importPath()))
+	for n, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			name[n] = '_'
+		}
+	}
+	if len(name) == 0 || unicode.IsDigit(name[0]) {
+		return "pkg" + string(name)
+	}
+	return string(name)
+}
+
+// packageFile returns the path of the package source file created in the input directory.
+func (s Scenario) packageFile(dir string) string {
+	return filepath.Join(dir, s.packageName()+".go")
+}
 
-		gomodFile, createErr := stage.CreateFileAll(relPath, newFilePerm, newDirPerm)
-		if createErr != nil {
-			return errors.Wrapf(createErr,
-				"failed to create go.mod in scenario [%s] working directory [%s]", s.String(), s.Wd(),
-			)
-		}
+// packageSource returns the content of a package source file whose Origin constant holds the input value.
+func (s Scenario) packageSource(origin string) string {
+	return fmt.Sprintf(
+		"package %s\n\n// Origin identifies which copy of the package was loaded.\nconst Origin = %q\n",
+		s.packageName(), origin,
+	)
+}
 
-		if _, writeErr := gomodFile.WriteString("module wd\n"); writeErr != nil {
-			return errors.Wrapf(writeErr,
-				"failed to update go.mod in scenario [%s] working directory [%s]", s.String(), s.Wd(),
-			)
-		}
-	} else {
-		relPath, pathErr := filepath.Rel(stage.Path(), s.Wd())
-		if pathErr != nil {
-			return errors.Wrapf(pathErr,
-				"failed to get relative path from [%s] to [%s]", stage.Path(), s.Wd(),
-			)
-		}
+// writeStageFile creates a file, and all non-existent ancestor directories, in the stage.
+func writeStageFile(stage *cage_file_stage.Stage, name, content string) error {
+	relPath, pathErr := filepath.Rel(stage.Path(), name)
+	if pathErr != nil {
+		return errors.Wrapf(pathErr, "failed to get relative path from [%s] to [%s]", stage.Path(), name)
+	}
 
-		if mkdirErr := stage.MkdirAll(relPath, newDirPerm); mkdirErr != nil {
-			return errors.Wrapf(mkdirErr, "failed to create go.mod in scenario [%s] working directory [%s]", s.String(), s.Wd())
-		}
+	f, createErr := stage.CreateFileAll(relPath, newFilePerm, newDirPerm)
+	if createErr != nil {
+		return errors.WithStack(createErr)
+	}
+
+	if _, writeErr := f.WriteString(content); writeErr != nil {
+		return errors.Wrapf(writeErr, "failed to write file [%s]", name)
 	}
 
 	return nil
@@ -129,14 +1183,25 @@ func (s Scenario) BeforeRun(stage *cage_file_stage.Stage) error {
 
 // Run applies the permutation-defined fields, runs the command, and returns the result.
 func (s Scenario) Run(ctx context.Context, args []string) (res Result, err error) {
-	// collectCmdRes runs the command with permutation-defined config applied.
-	collectCmdRes := func(cmd *exec.Cmd) (stdout, stderr string, pipeRes cage_exec.PipelineResult, err error) {
-		cmd.Env = append(os.Environ(), []string{
-			"GO111MODULE=" + s.GO111MODULE,
-			"GOFLAGS=" + s.GOFLAGS,
-			"GOPATH=" + s.Gopath(),
-		}...)
+	name := s.String()
+
+	extraEnv, err := s.ExtraEnv()
+	if err != nil {
+		return Result{}, errors.Wrapf(err, "failed to prepare environment of scenario [%s]", name)
+	}
+
+	// applyConfig applies the permutation-defined config, and the input "KEY=VALUE" pairs, to the command.
+	applyConfig := func(cmd *exec.Cmd, pairs ...string) {
+		hostEnv, _ := s.hostEnv()
+		env := s.env(append(append([]string{}, hostEnv...), extraEnv...))
+		env.SetPairs(pairs)
+		cmd.Env = env.Environ()
 		cmd.Dir = s.Wd()
+	}
+
+	// collectCmdRes runs the command with permutation-defined config, and the input "KEY=VALUE" pairs, applied.
+	collectCmdRes := func(cmd *exec.Cmd, pairs ...string) (stdout, stderr string, pipeRes cage_exec.PipelineResult, err error) {
+		applyConfig(cmd, pairs...)
 
 		stdoutBuf, stderrBuf, pipeRes, cmdErr := s.executor.Buffered(ctx, cmd)
 
@@ -148,37 +1213,337 @@ func (s Scenario) Run(ctx context.Context, args []string) (res Result, err error
 		return stdoutBuf.String(), stderrBuf.String(), pipeRes, cmdErr
 	}
 
-	name := s.String()
 	res = NewResult(s)
+	_, res.DroppedEnv = s.hostEnv()
 
 	// Collect `go env` output to display if the scenario fails.
 
 	goEnvCmd := s.executor.Command("go", "env")
-	if goEnvStdout, _, _, err := collectCmdRes(goEnvCmd); err == nil {
-		res.GoEnv = goEnvStdout
-	} else {
-		return Result{}, errors.Wrapf(err, "failed to run 'go env' for scenario [%s]", name)
+	goEnvStdout, goEnvStderr, _, err := collectCmdRes(goEnvCmd)
+	res.GoEnv = goEnvStdout
+	res.GoMod = goEnvValue(goEnvStdout, "GOMOD")
+	if err != nil {
+		// Some scenarios are expected to break the go command itself, so report the failure as the scenario's
+		// result instead of aborting all scenarios. `go env` does not parse go.mod, so MALFORMED_GOMOD scenarios
+		// still reach the subject, but it fails if:
+		//   - GO_DIRECTIVE or TOOLCHAIN selects a newer version and GOTOOLCHAIN allows switching, e.g. "auto",
+		//     so the go command fails to download the toolchain.
+		//   - Config.InvalidEnvAxes selects a value which the go command rejects, e.g. GO111MODULE=yes.
+		res.Err = errors.Wrapf(err, "failed to run 'go env' for scenario [%s]: %s", name, strings.TrimSpace(goEnvStderr))
+		res.Outcome = EnvErrorOutcome
+		if ctx.Err() != nil {
+			res.Outcome = TimeoutOutcome
+		}
+		return res, nil
+	}
+
+	// Snapshot the read-only tree so that writes which succeed anyway, e.g. as root, can be detected.
+
+	readOnlyDir := s.readOnlyDir()
+	var readOnlySnap treeSnapshot
+	if readOnlyDir != "" {
+		if readOnlySnap, err = snapshotTree(readOnlyDir); err != nil {
+			return Result{}, errors.Wrapf(err, "failed to snapshot read-only directory in scenario [%s]", name)
+		}
 	}
 
 	// Run the input command.
 
+	if args, err = s.SubjectArgs(args); err != nil {
+		return Result{}, errors.Wrapf(err, "failed to prepare arguments of scenario [%s]", name)
+	}
+
+	subjectEnv, err := s.SubjectEnv()
+	if err != nil {
+		return Result{}, errors.WithStack(err)
+	}
+
+	// Remove any report from a previous run, e.g. of the same stage, so it is not mistaken for a new one.
+	if err = os.Remove(s.ResultFile()); err != nil && !os.IsNotExist(err) {
+		return Result{}, errors.Wrapf(err, "failed to remove result file of scenario [%s]", name)
+	}
+
 	var subjectCmd *exec.Cmd
 	if len(args) == 1 {
 		subjectCmd = s.executor.Command(args[0]) // #nosec
 	} else {
 		subjectCmd = s.executor.Command(args[0], args[1:]...) // #nosec
 	}
-	subjectStdout, subjectStderr, pipeRes, err := collectCmdRes(subjectCmd)
-
-	res.Code = pipeRes.Cmd[subjectCmd].Code
-	res.Err = err
-	res.Stderr = strings.TrimSpace(subjectStderr)
-	res.Stdout = strings.TrimSpace(subjectStdout)
+	switch s.TTY {
+	case PipeTty:
+		subjectStdout, subjectStderr, pipeRes, cmdErr := collectCmdRes(subjectCmd, subjectEnv...)
+		res.Code = pipeRes.Cmd[subjectCmd].Code
+		res.Err = cmdErr
+		res.Stderr = strings.TrimSpace(subjectStderr)
+		res.Stdout = strings.TrimSpace(subjectStdout)
+	case PtyTty:
+		applyConfig(subjectCmd, subjectEnv...)
+		transcript, cmdRes, cmdErr := s.executor.PtyBuffered(ctx, subjectCmd)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			cmdErr = ctxErr
+		}
+		res.Code = cmdRes.Code
+		res.Err = cmdErr
+		// Undo the terminal's output translation so the transcript can be matched like Stdout/Stderr.
+		res.Transcript = strings.TrimSpace(strings.Replace(transcript.String(), "\r\n", "\n", -1))
+	default:
+		panic(errors.Errorf("scenario generator used an invalid TTY mode [%d]", s.TTY))
+	}
 	res.Scenario = s
 
+	report, reportErr := readSubjectReport(s.ResultFile())
+	if reportErr != nil && res.Err == nil {
+		// The subject meant to report a result but it cannot be trusted.
+		res.Err = reportErr
+	}
+	res.Report = report
+
+	res.Outcome = res.classify(ctx.Err())
+
+	if readOnlyDir != "" {
+		snap, snapErr := snapshotTree(readOnlyDir)
+		if snapErr != nil {
+			return Result{}, errors.Wrapf(snapErr, "failed to snapshot read-only directory in scenario [%s]", name)
+		}
+		res.ReadOnlyWrites = snap.changedPaths(readOnlySnap)
+	}
+
 	return res, nil
 }
 
+// hostEnv returns the host environment variables inherited by the scenario's commands, and the names of
+// those which are dropped because Config.Hermetic is true.
+func (s Scenario) hostEnv() (kept, dropped []string) {
+	host := s.hostEnviron
+	if host == nil {
+		host = os.Environ()
+	}
+	if !s.config.Hermetic {
+		return host, nil
+	}
+	return HermeticEnv(host, s.config.PassEnv)
+}
+
+// WithHostEnv returns a copy of the scenario which inherits the input "KEY=VALUE" pairs instead of os.Environ.
+func (s Scenario) WithHostEnv(host []string) Scenario {
+	s.hostEnviron = append([]string{}, host...)
+	return s
+}
+
+// env returns the environment of the scenario's commands: the input variables, e.g. from hostEnv,
+// with the permutation-defined variables assigned or removed.
+func (s Scenario) env(base []string) *Env {
+	env := NewEnv(base)
+	env.SetPairs(s.Environ())
+	env.Set("PWD", s.Wd()) // os/exec does not update an inherited PWD to match Cmd.Dir
+
+	for _, name := range s.Unsetenv() {
+		env.Unset(name)
+	}
+	return env
+}
+
+// Unsetenv returns the names of environment variables which the permutation removes from the environment.
+func (s Scenario) Unsetenv() (names []string) {
+	if s.GO111MODULE == UnsetValue {
+		names = append(names, "GO111MODULE")
+	}
+	if s.GOFLAGS == UnsetValue {
+		names = append(names, "GOFLAGS")
+	}
+	if s.GOPATH == UnsetGopath {
+		names = append(names, "GOPATH")
+	}
+	if len(s.config.Goproxies) > 0 && s.GOPROXY == UnsetGoproxy {
+		names = append(names, "GOPROXY")
+	}
+	if len(s.config.Privates) > 0 && s.PRIVATE == UnsetPrivateModules {
+		names = append(names, "GOPRIVATE", "GONOSUMDB", "GOINSECURE")
+	}
+	return names
+}
+
+// Environ returns the permutation-defined environment variables in "KEY=VALUE" format.
+//
+// Variables listed by Unsetenv are omitted.
+func (s Scenario) Environ() []string {
+	var env []string
+	if s.GO111MODULE != UnsetValue {
+		env = append(env, "GO111MODULE="+s.GO111MODULE)
+	}
+	if s.GOFLAGS != UnsetValue {
+		env = append(env, "GOFLAGS="+s.GOFLAGS)
+	}
+	if s.GOPATH != UnsetGopath {
+		env = append(env, "GOPATH="+s.Gopath())
+	}
+	env = append(env,
+		"HOME="+s.Home(),
+		"XDG_CONFIG_HOME="+s.XdgConfigHome(),
+		"GOENV="+s.Goenv(),
+	)
+	if gomodcache := s.Gomodcache(); gomodcache != "" {
+		env = append(env, "GOMODCACHE="+gomodcache)
+	}
+	if gocache := s.Gocache(); gocache != "" {
+		env = append(env, "GOCACHE="+gocache)
+	}
+	if len(s.config.Goproxies) > 0 && s.GOPROXY != UnsetGoproxy {
+		env = append(env, "GOPROXY="+s.Goproxy())
+	}
+	if len(s.config.Privates) > 0 && s.PRIVATE != UnsetPrivateModules {
+		// Assign all three so that only the selected variable, and not a host value, affects the scenario.
+		privateEnv := map[int]string{
+			GoprivateModules:  "GOPRIVATE",
+			GonosumdbModules:  "GONOSUMDB",
+			GoinsecureModules: "GOINSECURE",
+		}
+		for _, mode := range []int{GoprivateModules, GonosumdbModules, GoinsecureModules} {
+			if mode == s.PRIVATE {
+				env = append(env, privateEnv[mode]+"="+s.fixturePatterns())
+			} else {
+				env = append(env, privateEnv[mode]+"=")
+			}
+		}
+	}
+	if len(s.config.Toolchains) > 0 {
+		if s.TOOLCHAIN == NewerLocalToolchain {
+			env = append(env, "GOTOOLCHAIN=local")
+		} else {
+			env = append(env, "GOTOOLCHAIN=auto")
+		}
+	}
+	if s.VCS == UnsafeVcs {
+		// Changing the repository's owner would require privileges, so use git's own switch for simulating it.
+		env = append(env, "GIT_TEST_ASSUME_DIFFERENT_OWNER=1")
+	}
+	if goos, goarch := s.Platform(); goos != "" {
+		env = append(env, "GOOS="+goos, "GOARCH="+goarch)
+	}
+	switch s.CGO {
+	case EnabledCgo:
+		env = append(env, "CGO_ENABLED=1")
+	case DisabledCgo:
+		env = append(env, "CGO_ENABLED=0")
+	}
+	return env
+}
+
+// SubjectArgs returns a copy of the command's arguments after template expansion, if Config.TemplateArgs is true,
+// and after PatternPlaceholder is replaced by Pattern, if Config.Patterns is non-empty.
+func (s Scenario) SubjectArgs(args []string) ([]string, error) {
+	expanded := make([]string, len(args))
+	for n, arg := range args {
+		if s.config.TemplateArgs {
+			var err error
+			if arg, err = s.ExpandTemplate(arg); err != nil {
+				return nil, errors.Wrapf(err, "failed to expand argument %d", n)
+			}
+		}
+		if len(s.config.Patterns) > 0 {
+			arg = strings.Replace(arg, PatternPlaceholder, s.Pattern(), -1)
+		}
+		expanded[n] = arg
+	}
+	return expanded, nil
+}
+
+// ExtraEnv returns the Config.Env variables after template expansion of their values, if Config.TemplateEnv is true.
+func (s Scenario) ExtraEnv() (pairs []string, err error) {
+	for _, pair := range s.config.Env {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, errors.Errorf("variable [%s] is not in KEY=VALUE format", pair)
+		}
+		value := parts[1]
+		if s.config.TemplateEnv {
+			if value, err = s.ExpandTemplate(value); err != nil {
+				return nil, errors.Wrapf(err, "failed to expand variable [%s]", parts[0])
+			}
+		}
+		pairs = append(pairs, parts[0]+"="+value)
+	}
+	return pairs, nil
+}
+
+// ExpandTemplate executes the input text/template with the scenario as data, so it can refer to exported
+// fields and methods, e.g. "{{.Wd}}" or "{{.GO111MODULE}}".
+func (s Scenario) ExpandTemplate(text string) (string, error) {
+	tmpl, err := template.New("").Parse(text)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to parse template [%s]", text)
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, s); err != nil {
+		return "", errors.Wrapf(err, "failed to execute template [%s]", text)
+	}
+	return b.String(), nil
+}
+
+// Pattern returns the package pattern selected by PATTERN, which names the working directory's package.
+func (s Scenario) Pattern() string {
+	switch s.PATTERN {
+	case DotPattern:
+		return "."
+	case DotRecursivePattern:
+		return "./..."
+	case ImportPathPattern:
+		return s.WdImportPath()
+	case AbsDirPattern:
+		return s.Wd()
+	case RelDirPattern:
+		return ".." + string(filepath.Separator) + filepath.Base(s.Wd())
+	default:
+		panic(errors.Errorf("scenario generator used an invalid PATTERN mode [%d]", s.PATTERN))
+	}
+}
+
+// WdImportPath returns the import path of the working directory's package in the module which contains it,
+// e.g. NestedModulePath if NESTED_MODULE selects a working directory inside the nested module.
+//
+// It is computed from the module path even if IN_MODULE is false, in which case the go command may not
+// resolve it.
+func (s Scenario) WdImportPath() string {
+	modulePath := s.ModulePath()
+	if s.nestedWdDir() != "" {
+		modulePath = s.NestedModulePath()
+	}
+	return path.Join(modulePath, filepath.ToSlash(s.SpecialDir()))
+}
+
+// Platform returns the GOOS and GOARCH values selected by PLATFORM, or empty strings if they are inherited.
+func (s Scenario) Platform() (goos, goarch string) {
+	switch s.PLATFORM {
+	case HostPlatform:
+		return "", ""
+	case LinuxAmd64Platform:
+		return "linux", "amd64"
+	case WindowsAmd64Platform:
+		return "windows", "amd64"
+	case DarwinArm64Platform:
+		return "darwin", "arm64"
+	default:
+		panic(errors.Errorf("scenario generator used an invalid PLATFORM mode [%d]", s.PLATFORM))
+	}
+}
+
+// platformFiles returns the content of the package files created in ModuleRoot if the PLATFORM or CGO axis
+// is enabled, indexed by file name. Build constraints select a different file set on each platform.
+func (s Scenario) platformFiles() map[string]string {
+	pkg := "package " + s.packageName() + "\n"
+	files := map[string]string{
+		"platform.go":       pkg,
+		"platform_cgo.go":   pkg + "\n// #include <stdlib.h>\nimport \"C\"\n\n// Cgo is true if the package was built with cgo.\nconst Cgo = true\n",
+		"platform_nocgo.go": "//go:build !cgo\n// +build !cgo\n\n" + pkg + "\n// Cgo is true if the package was built with cgo.\nconst Cgo = false\n",
+	}
+	for _, goos := range []string{"linux", "windows", "darwin"} {
+		files["platform_"+goos+".go"] = fmt.Sprintf(
+			"%s\n// Platform identifies which GOOS-specific file was loaded.\nconst Platform = %q\n", pkg, goos,
+		)
+	}
+	return files
+}
+
 // GetRootDir returns the top of the scenario's file tree.
 func (s Scenario) GetRootDir() string {
 	return s.rootDir
@@ -186,7 +1551,7 @@ func (s Scenario) GetRootDir() string {
 
 // String returns a scenario identifier for display.
 func (s Scenario) String() string {
-	return fmt.Sprintf(
+	str := fmt.Sprintf(
 		"GO111MODULE=%s "+
 			"GOFLAGS=%s "+
 			"GOPATH=%s "+
@@ -194,10 +1559,113 @@ func (s Scenario) String() string {
 			"Wd=%s",
 		s.GO111MODULE,
 		s.GOFLAGS,
-		s.Gopath(),
+		s.gopathLabel(),
 		s.IN_MODULE,
 		s.Wd(),
 	)
+	for _, axis := range s.config.axes() {
+		str += " " + axis + "=" + s.optionalLabel(axis)
+	}
+	return str
+}
+
+// AxisLabels returns a display label of the scenario's value for each permuted axis, indexed by axis name.
+func (s Scenario) AxisLabels() map[string]string {
+	labels := map[string]string{
+		"GO111MODULE": s.GO111MODULE,
+		"GOFLAGS":     s.GOFLAGS,
+	}
+	if s.GOFLAGS == "" {
+		labels["GOFLAGS"] = "<empty>"
+	}
+	switch s.GOPATH {
+	case EmptyGopath:
+		labels["GOPATH"] = "<empty>"
+	case UsableGopath:
+		labels["GOPATH"] = "a file tree that may contain WD"
+	case UnusedGopath:
+		labels["GOPATH"] = "a file that never contains WD"
+	case UnsetGopath:
+		labels["GOPATH"] = UnsetValue
+	case RelativeGopath:
+		labels["GOPATH"] = "a relative path"
+	case GorootGopath:
+		labels["GOPATH"] = "GOROOT"
+	case FileGopath:
+		labels["GOPATH"] = "a regular file"
+	}
+	if s.IN_MODULE {
+		labels["IN_MODULE"] = "inside a module"
+	} else {
+		labels["IN_MODULE"] = "outside a module"
+	}
+	switch s.WD {
+	case WdInsideGopath:
+		labels["WD"] = "inside the GOPATH"
+	case WdOutsideGopath:
+		labels["WD"] = "outside the GOPATH"
+	}
+	for _, axis := range s.config.axes() {
+		labels[axis] = s.optionalLabel(axis)
+	}
+	return labels
+}
+
+// gopathLabel returns the GOPATH value for display, or UnsetValue if it is removed from the environment.
+func (s Scenario) gopathLabel() string {
+	if s.GOPATH == UnsetGopath {
+		return UnsetValue
+	}
+	return s.Gopath()
+}
+
+// optionalLabel returns a display label of the scenario's value for an optional axis.
+func (s Scenario) optionalLabel(axis string) string {
+	switch axis {
+	case "LAYOUT":
+		return ModeName(axis, s.LAYOUT)
+	case "GOENV":
+		return ModeName(axis, s.GOENV)
+	case "MODCACHE":
+		return ModeName(axis, s.MODCACHE)
+	case "GOPROXY":
+		return ModeName(axis, s.GOPROXY)
+	case "PRIVATE":
+		return ModeName(axis, s.PRIVATE)
+	case "PROXY_FAULT":
+		return ModeName(axis, s.PROXY_FAULT)
+	case "VCS":
+		return ModeName(axis, s.VCS)
+	case "GO_DIRECTIVE":
+		return ModeName(axis, s.GO_DIRECTIVE)
+	case "TOOLCHAIN":
+		return ModeName(axis, s.TOOLCHAIN)
+	case "PATH_SHAPE":
+		return ModeName(axis, s.PATH_SHAPE)
+	case "SPECIAL_DIR":
+		return ModeName(axis, s.SPECIAL_DIR)
+	case "NESTED_MODULE":
+		return ModeName(axis, s.NESTED_MODULE)
+	case "MOD_DIRECTIVE":
+		return ModeName(axis, s.MOD_DIRECTIVE)
+	case "MAJOR_VERSION":
+		return ModeName(axis, s.MAJOR_VERSION)
+	case "GOSUM":
+		return ModeName(axis, s.GOSUM)
+	case "MALFORMED_GOMOD":
+		return ModeName(axis, s.MALFORMED_GOMOD)
+	case "PLATFORM":
+		return ModeName(axis, s.PLATFORM)
+	case "CGO":
+		return ModeName(axis, s.CGO)
+	case "READ_ONLY":
+		return ModeName(axis, s.READ_ONLY)
+	case "TTY":
+		return ModeName(axis, s.TTY)
+	case "PATTERN":
+		return ModeName(axis, s.PATTERN)
+	}
+	return ""
 }
 
 // PermuteAxes enumerates all the fields whose possible values should yield permutations, e.g. "size" and "color".
@@ -205,6 +1673,9 @@ func (s Scenario) String() string {
 // It implements Permutator.
 func (s *Scenario) PermuteAxes() (axes []interface{}) {
 	axes = append(axes, "GO111MODULE", "GOFLAGS", "GOPATH", "IN_MODULE", "WD")
+	for _, axis := range s.config.axes() {
+		axes = append(axes, axis)
+	}
 	return axes
 }
 
@@ -213,6 +1684,7 @@ func (s *Scenario) PermuteAxes() (axes []interface{}) {
 // It implements Permutator.
 func (s *Scenario) PermuteSubject() interface{} {
 	scenario := Scenario{
+		config:   s.config,
 		executor: s.executor,
 		rootDir:  s.rootDir,
 	}
@@ -235,6 +1707,48 @@ func (s *Scenario) PermuteNew(subject, axis, value interface{}) interface{} {
 		n.IN_MODULE = value.(bool) //nolint:errcheck
 	case "WD":
 		n.WD = value.(int) //nolint:errcheck
+	case "LAYOUT":
+		n.LAYOUT = value.(int) //nolint:errcheck
+	case "GOENV":
+		n.GOENV = value.(int) //nolint:errcheck
+	case "MODCACHE":
+		n.MODCACHE = value.(int) //nolint:errcheck
+	case "GOPROXY":
+		n.GOPROXY = value.(int) //nolint:errcheck
+	case "PRIVATE":
+		n.PRIVATE = value.(int) //nolint:errcheck
+	case "PROXY_FAULT":
+		n.PROXY_FAULT = value.(int) //nolint:errcheck
+	case "VCS":
+		n.VCS = value.(int) //nolint:errcheck
+	case "GO_DIRECTIVE":
+		n.GO_DIRECTIVE = value.(int) //nolint:errcheck
+	case "TOOLCHAIN":
+		n.TOOLCHAIN = value.(int) //nolint:errcheck
+	case "PATH_SHAPE":
+		n.PATH_SHAPE = value.(int) //nolint:errcheck
+	case "SPECIAL_DIR":
+		n.SPECIAL_DIR = value.(int) //nolint:errcheck
+	case "NESTED_MODULE":
+		n.NESTED_MODULE = value.(int) //nolint:errcheck
+	case "MOD_DIRECTIVE":
+		n.MOD_DIRECTIVE = value.(int) //nolint:errcheck
+	case "MAJOR_VERSION":
+		n.MAJOR_VERSION = value.(int) //nolint:errcheck
+	case "GOSUM":
+		n.GOSUM = value.(int) //nolint:errcheck
+	case "MALFORMED_GOMOD":
+		n.MALFORMED_GOMOD = value.(int) //nolint:errcheck
+	case "PLATFORM":
+		n.PLATFORM = value.(int) //nolint:errcheck
+	case "CGO":
+		n.CGO = value.(int) //nolint:errcheck
+	case "READ_ONLY":
+		n.READ_ONLY = value.(int) //nolint:errcheck
+	case "TTY":
+		n.TTY = value.(int) //nolint:errcheck
+	case "PATTERN":
+		n.PATTERN = value.(int) //nolint:errcheck
 	}
 	return n
 }
@@ -243,11 +1757,153 @@ func (s Scenario) Id() int {
 	return s.permuteId
 }
 
+// ScenarioDir returns the top of the file tree dedicated to this particular scenario.
+//
+// Its path is shaped by PATH_SHAPE, e.g. to contain spaces.
+func (s Scenario) ScenarioDir() string {
+	dir := filepath.Join(s.rootDir, strconv.Itoa(s.permuteId))
+	switch s.PATH_SHAPE {
+	case PlainPathShape, SymlinkWdPathShape, SymlinkGopathPathShape:
+		return dir
+	case SpacesPathShape:
+		return filepath.Join(dir, "path with spaces")
+	case UnicodePathShape:
+		return filepath.Join(dir, "pâth_ünïcödé_路径")
+	case LongPathShape:
+		for len(dir) < longPathLen {
+			dir = filepath.Join(dir, longPathSegment)
+		}
+		return dir
+	default:
+		panic(errors.Errorf("scenario generator used an invalid PATH_SHAPE mode [%d]", s.PATH_SHAPE))
+	}
+}
+
+// Home returns the scenario's isolated HOME directory.
+//
+// It also contains the XDG_CONFIG_HOME directory, and the GOENV file, so the go command neither
+// reads nor writes the invoking user's GOPATH default, module cache, or persisted `go env -w` config.
+func (s Scenario) Home() string {
+	return filepath.Join(s.ScenarioDir(), "home")
+}
+
+// XdgConfigHome returns the scenario's isolated XDG_CONFIG_HOME directory.
+func (s Scenario) XdgConfigHome() string {
+	return filepath.Join(s.Home(), ".config")
+}
+
+// Goenv returns the path to the scenario's isolated GOENV file.
+func (s Scenario) Goenv() string {
+	return filepath.Join(s.XdgConfigHome(), "go", "env")
+}
+
+// Gomodcache returns the scenario's GOMODCACHE, or an empty string if the MODCACHE axis is disabled.
+func (s Scenario) Gomodcache() string {
+	if len(s.config.Modcaches) == 0 {
+		return ""
+	}
+	return filepath.Join(s.ScenarioDir(), "gomodcache")
+}
+
+// Gocache returns the scenario's GOCACHE, or an empty string if the go command should select it.
+//
+// If Config.SharedGocache is true, all scenarios share one build cache. Otherwise each scenario has its own
+// if the MODCACHE axis is enabled, so that cache state is not shared across scenarios.
+func (s Scenario) Gocache() string {
+	if s.config.SharedGocache {
+		return filepath.Join(s.rootDir, "gocache")
+	}
+	if len(s.config.Modcaches) == 0 {
+		return ""
+	}
+	return filepath.Join(s.ScenarioDir(), "gocache")
+}
+
+// FileProxyDir returns the "file://" GOPROXY file tree shared by all scenarios.
+func (s Scenario) FileProxyDir() string {
+	return filepath.Join(s.rootDir, "goproxy")
+}
+
+// Goproxy returns the GOPROXY value selected by the GOPROXY mode, or an empty string if it is unset.
+func (s Scenario) Goproxy() string {
+	switch s.GOPROXY {
+	case OffGoproxy:
+		return "off"
+	case DirectGoproxy:
+		return "direct"
+	case FileGoproxy:
+		proxyPath := filepath.ToSlash(s.FileProxyDir())
+		if !strings.HasPrefix(proxyPath, "/") { // e.g. Windows volume names
+			proxyPath = "/" + proxyPath
+		}
+		return "file://" + proxyPath
+	case HTTPGoproxy:
+		return s.config.ProxyURL + "/" + ModeName("PROXY_FAULT", s.PROXY_FAULT)
+	case UnsetGoproxy:
+		return ""
+	default:
+		panic(errors.Errorf("scenario generator used an invalid GOPROXY mode [%d]", s.GOPROXY))
+	}
+}
+
+// Modfile returns the absolute path of the alternate go.mod selected by "-modfile" in GOFLAGS,
+// or an empty string if it is not selected.
+func (s Scenario) Modfile() string {
+	modfile := goflagValue(s.GOFLAGS, "-modfile")
+	if modfile == "" || filepath.IsAbs(modfile) {
+		return modfile
+	}
+	return filepath.Join(s.Wd(), modfile) // relative to the go command's working directory
+}
+
+// GoDirective returns the version in the go.mod go directive, or an empty string if it is omitted.
+func (s Scenario) GoDirective() string {
+	switch s.GO_DIRECTIVE {
+	case NoGoDirective:
+		return ""
+	case Go111GoDirective:
+		return "1.11"
+	case Go114GoDirective:
+		return "1.14"
+	case Go117GoDirective:
+		return "1.17"
+	case Go121GoDirective:
+		return "1.21"
+	case NewerGoDirective:
+		return newerGoVersion
+	default:
+		panic(errors.Errorf("scenario generator used an invalid GO_DIRECTIVE mode [%d]", s.GO_DIRECTIVE))
+	}
+}
+
+// VcsRoot returns the root of the scenario's git repository, or an empty string if VCS is NoVcs.
+func (s Scenario) VcsRoot() string {
+	switch s.VCS {
+	case NoVcs:
+		return ""
+	case CleanVcs, DirtyVcs, UnsafeVcs:
+		return s.ModuleRoot()
+	case SubdirVcs:
+		return filepath.Dir(s.ModuleRoot())
+	default:
+		panic(errors.Errorf("scenario generator used an invalid VCS mode [%d]", s.VCS))
+	}
+}
+
 func (s Scenario) UsableGopath() string {
-	return filepath.Join(s.rootDir, strconv.Itoa(s.permuteId), "usable_gopath")
+	return filepath.Join(s.ScenarioDir(), "usable_gopath")
 }
 
 func (s Scenario) Gopath() string {
+	gopath := s.realGopath()
+	if (s.GOPATH == UsableGopath || s.GOPATH == UnusedGopath) && s.PATH_SHAPE == SymlinkGopathPathShape {
+		return gopath + "_symlink"
+	}
+	return gopath
+}
+
+// realGopath returns the GOPATH value selected by the GOPATH mode, before any symlink selected by PATH_SHAPE.
+func (s Scenario) realGopath() string {
 	switch s.GOPATH {
 	case UsableGopath:
 		// UsableGopath is an path to a file tree which may contain the working directory value (Wd)
@@ -257,20 +1913,169 @@ func (s Scenario) Gopath() string {
 		// UnusedGopath complements UsableGopath by enabling permutations where the working directory value (Wd)
 		// is never a descendant. This enables permutations where the environment variable is non-empty/valid but the
 		// command "runs from outside the GOPATH".
-		return filepath.Join(s.rootDir, strconv.Itoa(s.permuteId), "unused_gopath")
-	case EmptyGopath:
+		return filepath.Join(s.ScenarioDir(), "unused_gopath")
+	case EmptyGopath, UnsetGopath:
 		return ""
+	case RelativeGopath:
+		return "relative_gopath"
+	case GorootGopath:
+		return s.config.Goroot
+	case FileGopath:
+		return filepath.Join(s.ScenarioDir(), "file_gopath")
 	default:
 		panic(errors.Errorf("scenario generator used an invalid GOPATH mode [%d]", s.GOPATH))
 	}
 }
 
+// ModulePath returns the module path declared by the go.mod created in the working directory.
+func (s Scenario) ModulePath() string {
+	switch s.MAJOR_VERSION {
+	case SubdirMajorVersion, BranchMajorVersion:
+		return s.unsuffixedModulePath() + "/" + majorVersionSuffix
+	default:
+		return s.unsuffixedModulePath()
+	}
+}
+
+// unsuffixedModulePath returns ModulePath without a major version suffix.
+func (s Scenario) unsuffixedModulePath() string {
+	switch s.LAYOUT {
+	case GopathSrcLayout, ShadowedLayout:
+		return s.config.importPath()
+	default:
+		return "wd"
+	}
+}
+
+// MajorDep returns the first required fixture module whose path has a major version suffix, e.g. "/v2".
+func (s Scenario) MajorDep() (FixtureModule, bool) {
+	for _, m := range s.requiredModules() {
+		if HasMajorSuffix(m.Path) {
+			return m, true
+		}
+	}
+	return FixtureModule{}, false
+}
+
+// HasMajorSuffix returns true if the module path ends with a "/vN" suffix where N is at least 2.
+func HasMajorSuffix(modulePath string) bool {
+	base := path.Base(modulePath)
+	if base == modulePath || !strings.HasPrefix(base, "v") {
+		return false
+	}
+	n, err := strconv.Atoi(base[1:])
+	return err == nil && n >= 2 && strconv.Itoa(n) == base[1:]
+}
+
+// majorSource returns the content of the MAJOR_VERSION axis's package source file.
+//
+// In DepMajorVersion it imports the MajorDep module's root package.
+func (s Scenario) majorSource() string {
+	source := "package " + s.packageName() + "\n"
+	if s.MAJOR_VERSION == DepMajorVersion {
+		if dep, ok := s.MajorDep(); ok {
+			source += "\nimport _ " + strconv.Quote(dep.Path) + "\n"
+		}
+	}
+	return source
+}
+
+// gopathSrcDir returns the directory of the import path under the usable GOPATH's src directory.
+func (s Scenario) gopathSrcDir() string {
+	return filepath.Join(s.UsableGopath(), "src", filepath.FromSlash(s.config.importPath()))
+}
+
+// RealWd returns the directory which Wd resolves to, e.g. through the ModuleRoot symlink in SymlinkWdPathShape.
+func (s Scenario) RealWd() string {
+	return filepath.Join(s.realModuleRoot(), s.nestedWdDir(), s.SpecialDir())
+}
+
+// realModuleRoot returns the directory which ModuleRoot resolves to, e.g. its symlink target in SymlinkWdPathShape.
+func (s Scenario) realModuleRoot() string {
+	if s.PATH_SHAPE == SymlinkWdPathShape {
+		return filepath.Join(s.ScenarioDir(), "wd_symlink_target")
+	}
+	return s.ModuleRoot()
+}
+
+// Wd returns the working directory in which the command runs.
+//
+// It is the ModuleRoot, or a descendant selected by NESTED_MODULE and SPECIAL_DIR.
 func (s Scenario) Wd() string {
+	return filepath.Join(s.ModuleRoot(), s.nestedWdDir(), s.SpecialDir())
+}
+
+// NestedModuleDir returns the directory of the module nested in ModuleRoot's module, or an empty string
+// if NESTED_MODULE does not create one.
+func (s Scenario) NestedModuleDir() string {
+	if s.NESTED_MODULE == NoNestedModule {
+		return ""
+	}
+	return filepath.Join(s.ModuleRoot(), nestedModuleDir)
+}
+
+// NestedModulePath returns the module path of the module in NestedModuleDir.
+func (s Scenario) NestedModulePath() string {
+	return s.ModulePath() + "/" + nestedModuleDir
+}
+
+// nestedWdDir returns the path, relative to ModuleRoot, of the module directory which contains the working directory.
+func (s Scenario) nestedWdDir() string {
+	switch s.NESTED_MODULE {
+	case NoNestedModule, ParentNestedModule:
+		return ""
+	case InsideNestedModule, ReplacedNestedModule:
+		return nestedModuleDir
+	default:
+		panic(errors.Errorf("scenario generator used an invalid NESTED_MODULE mode [%d]", s.NESTED_MODULE))
+	}
+}
+
+// SpecialDir returns the path of the working directory, selected by SPECIAL_DIR, relative to the module
+// directory which contains it.
+func (s Scenario) SpecialDir() string {
+	switch s.SPECIAL_DIR {
+	case NoSpecialDir:
+		return ""
+	case PackageSpecialDir, TestdataSpecialDir, UnderscoreSpecialDir, DotSpecialDir, VendorSpecialDir:
+		return ModeName("SPECIAL_DIR", s.SPECIAL_DIR) // the display names are the directory names
+	default:
+		panic(errors.Errorf("scenario generator used an invalid SPECIAL_DIR mode [%d]", s.SPECIAL_DIR))
+	}
+}
+
+// ModuleRoot returns the directory which contains the go.mod created if IN_MODULE is true.
+//
+// It is the working directory unless NESTED_MODULE or SPECIAL_DIR selects a descendant.
+func (s Scenario) ModuleRoot() string {
+	if s.MAJOR_VERSION == SubdirMajorVersion {
+		return filepath.Join(s.unsuffixedModuleRoot(), majorVersionSuffix)
+	}
+	return s.unsuffixedModuleRoot()
+}
+
+// unsuffixedModuleRoot returns the directory of the module without a major version suffix, which contains
+// the major subdirectory in SubdirMajorVersion.
+func (s Scenario) unsuffixedModuleRoot() string {
+	switch s.LAYOUT {
+	case FlatLayout:
+	case GopathSrcLayout, GopathSrcMismatchLayout:
+		// GopathSrcLayout and GopathSrcMismatchLayout place the working directory where GOPATH mode would
+		// resolve the import path, rather than just under the GOPATH root like WdInsideGopath.
+		return s.gopathSrcDir()
+	case ShadowedLayout:
+		// ShadowedLayout keeps the working directory out of the GOPATH so the copy of the package under
+		// GOPATH/src is a distinct, competing candidate for the same import path.
+		return filepath.Join(s.ScenarioDir(), "wd")
+	default:
+		panic(errors.Errorf("scenario generator used an invalid LAYOUT mode [%d]", s.LAYOUT))
+	}
+
 	switch s.WD {
 	case WdOutsideGopath:
 		// WdOutsideGopath aligns with UsableGopath/UnusedGopath, by being a descendent of neither, to enable
 		// permutations where the command "runs from outside the GOPATH."
-		return filepath.Join(s.rootDir, strconv.Itoa(s.permuteId), "wd")
+		return filepath.Join(s.ScenarioDir(), "wd")
 	case WdInsideGopath:
 		// WdInsideGopath aligns with UsableGopath to enable permutations where the command "runs from in the GOPATH."
 		return filepath.Join(s.UsableGopath(), "wd")
@@ -286,14 +2091,45 @@ func (s *Scenario) PermuteValues(axis interface{}) (values []interface{}) {
 	switch axis.(string) {
 	case "GO111MODULE":
 		values = append(values, "auto", "off", "on")
+		if s.config.UnsetEnvAxes {
+			values = append(values, UnsetValue)
+		}
+		if s.config.InvalidEnvAxes {
+			values = append(values, InvalidGo111module)
+		}
 	case "GOFLAGS":
-		values = append(values, "-mod=vendor", "")
+		goflags := []string{"-mod=vendor", ""}
+		if len(s.config.Goflags) > 0 {
+			goflags = ComposeGoflags(s.config.Goflags, s.config.GoflagsCompose)
+		}
+		for _, v := range goflags {
+			values = append(values, v)
+		}
+		if s.config.BuildvcsFalse {
+			for _, v := range goflags {
+				values = append(values, strings.TrimSpace(v+" -buildvcs=false"))
+			}
+		}
+		if s.config.UnsetEnvAxes {
+			values = append(values, UnsetValue)
+		}
+		if s.config.InvalidEnvAxes {
+			values = append(values, InvalidGoflags)
+		}
 	case "GOPATH":
 		values = append(values, EmptyGopath, UsableGopath, UnusedGopath)
+		if s.config.UnsetEnvAxes {
+			values = append(values, UnsetGopath)
+		}
+		if s.config.InvalidEnvAxes {
+			values = append(values, RelativeGopath, GorootGopath, FileGopath)
+		}
 	case "IN_MODULE":
 		values = append(values, true, false)
 	case "WD":
 		values = append(values, WdInsideGopath, WdOutsideGopath)
+	default:
+		values = s.config.values(axis.(string))
 	}
 	return values
 }
@@ -308,3 +2144,35 @@ func (s Scenario) PermuteId(subject interface{}, id int) interface{} {
 }
 
 var _ cage_algo.Permutator = (*Scenario)(nil)
+
+// Permute returns the permutations of the base scenario's axes, omitting those whose axis values conflict.
+//
+// The remaining scenarios are assigned consecutive IDs in permutation order.
+func Permute(base *Scenario) (scenarios []Scenario) {
+	for _, p := range tp_algo.Permute(base) {
+		s := p.(Scenario) //nolint:errcheck
+		if s.conflicts() {
+			continue
+		}
+		scenarios = append(scenarios, base.PermuteId(s, len(scenarios)).(Scenario)) //nolint:errcheck
+	}
+	return scenarios
+}
+
+// conflicts returns true if the scenario's LAYOUT cannot be arranged as its GOPATH and WD axes describe.
+//
+// The GOPATH/src layouts require the usable GOPATH, and a working directory which is inside it in
+// GopathSrcLayout and GopathSrcMismatchLayout, or outside it in ShadowedLayout. Permuting the other
+// GOPATH and WD values would mislabel the scenarios or duplicate them.
+func (s Scenario) conflicts() bool {
+	switch s.LAYOUT {
+	case FlatLayout:
+		return false
+	case GopathSrcLayout, GopathSrcMismatchLayout:
+		return s.GOPATH != UsableGopath || s.WD != WdInsideGopath
+	case ShadowedLayout:
+		return s.GOPATH != UsableGopath || s.WD != WdOutsideGopath
+	default:
+		panic(errors.Errorf("scenario generator used an invalid LAYOUT mode [%d]", s.LAYOUT))
+	}
+}
@@ -7,18 +7,32 @@
 package gomodfuzz_test
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	tp_algo "github.com/codeactual/gomodfuzz/internal/third_party/stackexchange/algo"
 
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 
+	cage_exec "github.com/codeactual/gomodfuzz/internal/cage/os/exec"
 	cage_exec_mocks "github.com/codeactual/gomodfuzz/internal/cage/os/exec/mocks"
+	cage_file "github.com/codeactual/gomodfuzz/internal/cage/os/file"
+	cage_file_stage "github.com/codeactual/gomodfuzz/internal/cage/os/file/stage"
 	testkit_file "github.com/codeactual/gomodfuzz/internal/cage/testkit/os/file"
+	testkit_filepath "github.com/codeactual/gomodfuzz/internal/cage/testkit/path/filepath"
 	testkit_require "github.com/codeactual/gomodfuzz/internal/cage/testkit/testify/require"
 	"github.com/codeactual/gomodfuzz/internal/gomodfuzz"
 )
@@ -34,6 +48,36 @@ func (s *ScenarioSuite) SetupTest() {
 	testkit_file.ResetTestdata(t)
 }
 
+// permuteCanonical returns the permutations of the config's axes which only differ in their optional axis values.
+//
+// The base axes have the values of a typical module-mode run: GO111MODULE=on, empty GOFLAGS, the usable
+// GOPATH, and a go.mod in a working directory outside the GOPATH. It asserts that one permutation is returned
+// for each combination of optional axis values, so tests can select scenarios by the values of their own axis.
+func (s *ScenarioSuite) permuteCanonical(executor cage_exec.Executor, rootDir string, config gomodfuzz.Config) (canonical []gomodfuzz.Scenario) {
+	t := s.T()
+
+	baseScenario := gomodfuzz.NewScenario(executor, rootDir, config)
+
+	combinations := 1
+	for _, axis := range baseScenario.PermuteAxes() {
+		switch axis {
+		case "GO111MODULE", "GOFLAGS", "GOPATH", "IN_MODULE", "WD":
+		default:
+			combinations *= len(baseScenario.PermuteValues(axis))
+		}
+	}
+
+	for _, scenario := range gomodfuzz.Permute(&baseScenario) {
+		if scenario.GOPATH == gomodfuzz.UsableGopath && scenario.IN_MODULE && scenario.WD == gomodfuzz.WdOutsideGopath &&
+			scenario.GO111MODULE == "on" && scenario.GOFLAGS == "" {
+			canonical = append(canonical, scenario)
+		}
+	}
+	require.Len(t, canonical, combinations)
+
+	return canonical
+}
+
 func (s *ScenarioSuite) TestPermute() {
 	t := s.T()
 
@@ -621,6 +665,1349 @@ func (s *ScenarioSuite) TestPermute() {
 	}
 }
 
+func (s *ScenarioSuite) TestPermuteLayout() {
+	t := s.T()
+
+	rootDir := filepath.Join(testkit_file.DynamicDataDir(), "permute_layout")
+	importPath := "example.com/org/proj"
+
+	config := gomodfuzz.Config{
+		Layouts:    []int{gomodfuzz.FlatLayout, gomodfuzz.GopathSrcLayout, gomodfuzz.GopathSrcMismatchLayout, gomodfuzz.ShadowedLayout},
+		ImportPath: importPath,
+	}
+	baseScenario := gomodfuzz.NewScenario(s.executor, rootDir, config)
+	permutations := gomodfuzz.Permute(&baseScenario)
+
+	require.Exactly(t, []interface{}{"GO111MODULE", "GOFLAGS", "GOPATH", "IN_MODULE", "WD", "LAYOUT"}, baseScenario.PermuteAxes())
+
+	// Only FlatLayout is permuted with every GOPATH and WD value.
+	require.Len(t, permutations, 72+12*(len(config.Layouts)-1))
+
+	layoutCounts := map[int]int{}
+
+	for n, actual := range permutations {
+		layoutCounts[actual.LAYOUT]++
+
+		// IDs remain consecutive after conflicting permutations are omitted.
+		require.Exactly(t, n, actual.Id())
+
+		permuteId := strconv.Itoa(actual.Id())
+		gopathSrcDir := filepath.Join(rootDir, permuteId, "usable_gopath", "src", "example.com", "org", "proj")
+
+		switch actual.LAYOUT {
+		case gomodfuzz.FlatLayout:
+			require.Exactly(t, "wd", actual.ModulePath())
+		case gomodfuzz.GopathSrcLayout:
+			require.Exactly(t, gomodfuzz.UsableGopath, actual.GOPATH)
+			require.Exactly(t, gomodfuzz.WdInsideGopath, actual.WD)
+			require.Exactly(t, gopathSrcDir, actual.Wd())
+			require.Exactly(t, importPath, actual.ModulePath())
+		case gomodfuzz.GopathSrcMismatchLayout:
+			require.Exactly(t, gomodfuzz.UsableGopath, actual.GOPATH)
+			require.Exactly(t, gomodfuzz.WdInsideGopath, actual.WD)
+			require.Exactly(t, gopathSrcDir, actual.Wd())
+			require.Exactly(t, "wd", actual.ModulePath())
+		case gomodfuzz.ShadowedLayout:
+			require.Exactly(t, gomodfuzz.UsableGopath, actual.GOPATH)
+			require.Exactly(t, gomodfuzz.WdOutsideGopath, actual.WD)
+			require.Exactly(t, filepath.Join(rootDir, permuteId, "wd"), actual.Wd())
+			require.Exactly(t, importPath, actual.ModulePath())
+		}
+
+		testkit_require.StringContains(t, actual.String(), "LAYOUT="+gomodfuzz.ModeName("LAYOUT", actual.LAYOUT))
+		require.Exactly(t, gomodfuzz.ModeName("LAYOUT", actual.LAYOUT), actual.AxisLabels()["LAYOUT"])
+	}
+
+	require.Exactly(t, 72, layoutCounts[gomodfuzz.FlatLayout])
+	for _, layout := range config.Layouts[1:] {
+		require.Exactly(t, 12, layoutCounts[layout])
+	}
+}
+
+func (s *ScenarioSuite) TestBeforeRunShadowedLayout() {
+	t := s.T()
+
+	rootDir := filepath.Join(testkit_file.DynamicDataDir(), "shadowed_layout")
+	stage := cage_file_stage.NewStage(rootDir)
+
+	config := gomodfuzz.Config{Layouts: []int{gomodfuzz.ShadowedLayout}, ImportPath: "example.com/org/proj"}
+	baseScenario := gomodfuzz.NewScenario(s.executor, rootDir, config)
+	scenario := baseScenario.PermuteNew(baseScenario.PermuteSubject(), "LAYOUT", gomodfuzz.ShadowedLayout).(gomodfuzz.Scenario)
+	scenario = scenario.PermuteNew(scenario, "IN_MODULE", true).(gomodfuzz.Scenario)
+	scenario = scenario.PermuteNew(scenario, "GOPATH", gomodfuzz.UsableGopath).(gomodfuzz.Scenario)
+	scenario = scenario.PermuteNew(scenario, "WD", gomodfuzz.WdOutsideGopath).(gomodfuzz.Scenario)
+
+	require.NoError(t, scenario.BeforeRun(stage))
+
+	goMod, err := ioutil.ReadFile(filepath.Join(scenario.Wd(), "go.mod"))
+	require.NoError(t, err)
+	require.Exactly(t, "module example.com/org/proj\n", string(goMod))
+
+	wdPkg, err := ioutil.ReadFile(filepath.Join(scenario.Wd(), "proj.go"))
+	require.NoError(t, err)
+	testkit_require.StringContains(t, string(wdPkg), "package proj\n", `const Origin = "wd"`)
+
+	shadowPkg, err := ioutil.ReadFile(filepath.Join(scenario.UsableGopath(), "src", "example.com", "org", "proj", "proj.go"))
+	require.NoError(t, err)
+	testkit_require.StringContains(t, string(shadowPkg), "package proj\n", `const Origin = "gopath"`)
+}
+
+func (s *ScenarioSuite) TestBeforeRunGoenv() {
+	t := s.T()
+
+	rootDir := filepath.Join(testkit_file.DynamicDataDir(), "goenv")
+	stage := cage_file_stage.NewStage(rootDir)
+
+	config := gomodfuzz.Config{
+		Goenvs:        []int{gomodfuzz.EmptyGoenv, gomodfuzz.WrittenGoenv},
+		GoenvSettings: []string{"GOPRIVATE=example.com/private", "GOFLAGS=-mod=mod"},
+	}
+	for _, scenario := range s.permuteCanonical(s.executor, rootDir, config) {
+		sid := scenario.String()
+
+		require.Exactly(t, filepath.Join(scenario.ScenarioDir(), "home"), scenario.Home(), sid)
+		require.Exactly(t, filepath.Join(scenario.Home(), ".config", "go", "env"), scenario.Goenv(), sid)
+
+		require.NoError(t, scenario.BeforeRun(stage), sid)
+
+		exists, _, err := cage_file.Exists(scenario.Home())
+		require.NoError(t, err, sid)
+		require.True(t, exists, sid)
+
+		goenv, err := ioutil.ReadFile(scenario.Goenv())
+		if scenario.GOENV == gomodfuzz.WrittenGoenv {
+			require.NoError(t, err, sid)
+			require.Exactly(t, "GOPRIVATE=example.com/private\nGOFLAGS=-mod=mod\n", string(goenv), sid)
+		} else {
+			require.True(t, os.IsNotExist(errors.Cause(err)), sid)
+		}
+	}
+}
+
+func (s *ScenarioSuite) TestBeforeRunModcache() {
+	t := s.T()
+
+	rootDir := filepath.Join(testkit_file.DynamicDataDir(), "modcache")
+	stage := cage_file_stage.NewStage(rootDir)
+
+	mods, err := gomodfuzz.LoadFixtureModules(filepath.Join(testkit_file.FixtureDataDir(), "modules"))
+	require.NoError(t, err)
+
+	config := gomodfuzz.Config{
+		Modcaches:      []int{gomodfuzz.EmptyModcache, gomodfuzz.SeededModcache, gomodfuzz.ReadOnlyModcache},
+		FixtureModules: mods,
+	}
+	for _, scenario := range s.permuteCanonical(s.executor, rootDir, config) {
+		sid := scenario.String()
+
+		require.Exactly(t, filepath.Join(scenario.ScenarioDir(), "gomodcache"), scenario.Gomodcache(), sid)
+		require.Exactly(t, filepath.Join(scenario.ScenarioDir(), "gocache"), scenario.Gocache(), sid)
+
+		require.NoError(t, scenario.BeforeRun(stage), sid)
+
+		fi, err := os.Stat(scenario.Gomodcache())
+		require.NoError(t, err, sid)
+
+		exists, _, err := cage_file.Exists(filepath.Join(scenario.Gomodcache(), "cache", "download", "gomodfuzz.test", "dep", "@v", "list"))
+		require.NoError(t, err, sid)
+
+		switch scenario.MODCACHE {
+		case gomodfuzz.EmptyModcache:
+			require.False(t, exists, sid)
+			require.Exactly(t, os.FileMode(0755), fi.Mode().Perm(), sid)
+		case gomodfuzz.SeededModcache:
+			require.True(t, exists, sid)
+			require.Exactly(t, os.FileMode(0755), fi.Mode().Perm(), sid)
+		case gomodfuzz.ReadOnlyModcache:
+			require.True(t, exists, sid)
+			require.Exactly(t, os.FileMode(0555), fi.Mode().Perm(), sid)
+		}
+
+		require.NoError(t, cage_file.RemoveAllSafer(testkit_filepath.Abs(t, scenario.ScenarioDir())), sid)
+	}
+
+	// GOMODCACHE/GOCACHE are left to the go command when the axis is disabled, unless GOCACHE is shared.
+
+	baseScenario := gomodfuzz.NewScenario(s.executor, rootDir, gomodfuzz.Config{SharedGocache: true})
+	scenario := tp_algo.Permute(&baseScenario)[0].(gomodfuzz.Scenario)
+	require.Exactly(t, "", scenario.Gomodcache())
+	require.Exactly(t, filepath.Join(rootDir, "gocache"), scenario.Gocache())
+}
+
+func (s *ScenarioSuite) TestGoproxyAndPrivate() {
+	t := s.T()
+
+	rootDir := filepath.Join(testkit_file.DynamicDataDirAbs(t), "goproxy")
+	stage := cage_file_stage.NewStage(rootDir)
+
+	mods, err := gomodfuzz.LoadFixtureModules(filepath.Join(testkit_file.FixtureDataDir(), "modules"))
+	require.NoError(t, err)
+
+	config := gomodfuzz.Config{
+		FixtureModules: mods,
+		Goproxies:      []int{gomodfuzz.OffGoproxy, gomodfuzz.DirectGoproxy, gomodfuzz.FileGoproxy},
+		Privates:       []int{gomodfuzz.PublicModules, gomodfuzz.GoprivateModules, gomodfuzz.GonosumdbModules, gomodfuzz.GoinsecureModules},
+	}
+
+	expectGoproxy := map[int]string{
+		gomodfuzz.OffGoproxy:    "GOPROXY=off",
+		gomodfuzz.DirectGoproxy: "GOPROXY=direct",
+		gomodfuzz.FileGoproxy:   "GOPROXY=file://" + filepath.ToSlash(filepath.Join(rootDir, "goproxy")),
+	}
+	expectPrivate := map[int][]string{
+		gomodfuzz.PublicModules:     {"GOPRIVATE=", "GONOSUMDB=", "GOINSECURE="},
+		gomodfuzz.GoprivateModules:  {"GOPRIVATE=gomodfuzz.test/dep", "GONOSUMDB=", "GOINSECURE="},
+		gomodfuzz.GonosumdbModules:  {"GOPRIVATE=", "GONOSUMDB=gomodfuzz.test/dep", "GOINSECURE="},
+		gomodfuzz.GoinsecureModules: {"GOPRIVATE=", "GONOSUMDB=", "GOINSECURE=gomodfuzz.test/dep"},
+	}
+
+	for _, scenario := range s.permuteCanonical(s.executor, rootDir, config) {
+		sid := scenario.String()
+
+		env := scenario.Environ()
+		require.Contains(t, env, expectGoproxy[scenario.GOPROXY], sid)
+		for _, v := range expectPrivate[scenario.PRIVATE] {
+			require.Contains(t, env, v, sid)
+		}
+
+		// go.mod requires the lowest version of each fixture module
+
+		require.NoError(t, scenario.BeforeRun(stage), sid)
+
+		goMod, err := ioutil.ReadFile(filepath.Join(scenario.Wd(), "go.mod"))
+		require.NoError(t, err, sid)
+		require.Exactly(t, "module wd\n\nrequire (\n\tgomodfuzz.test/dep v1.0.0\n)\n", string(goMod), sid)
+	}
+}
+
+func (s *ScenarioSuite) TestProxyFault() {
+	t := s.T()
+
+	rootDir := filepath.Join(testkit_file.DynamicDataDir(), "proxy_fault")
+	stage := cage_file_stage.NewStage(rootDir)
+
+	mods, err := gomodfuzz.LoadFixtureModules(filepath.Join(testkit_file.FixtureDataDir(), "modules"))
+	require.NoError(t, err)
+
+	config := gomodfuzz.Config{
+		FixtureModules: mods,
+		Goproxies:      []int{gomodfuzz.HTTPGoproxy},
+		ProxyFaults:    []int{gomodfuzz.NoProxyFault, gomodfuzz.SumMismatchProxyFault},
+		ProxyURL:       "http://127.0.0.1:1234",
+	}
+
+	expectGoproxy := map[int]string{
+		gomodfuzz.NoProxyFault:          "GOPROXY=http://127.0.0.1:1234/none",
+		gomodfuzz.SumMismatchProxyFault: "GOPROXY=http://127.0.0.1:1234/sum_mismatch",
+	}
+
+	for _, scenario := range s.permuteCanonical(s.executor, rootDir, config) {
+		sid := scenario.String()
+
+		require.Contains(t, scenario.Environ(), expectGoproxy[scenario.PROXY_FAULT], sid)
+
+		// go.sum holds the genuine hashes so tampered downloads can be detected
+
+		require.NoError(t, scenario.BeforeRun(stage), sid)
+
+		goSum, err := ioutil.ReadFile(filepath.Join(scenario.Wd(), "go.sum"))
+		require.NoError(t, err, sid)
+		require.Exactly(t,
+			"gomodfuzz.test/dep v1.0.0 h1:uvo5zYcoULaCDqLkE1aO3XX07h0FZhhLvX0Tca0owV8=\n"+
+				"gomodfuzz.test/dep v1.0.0/go.mod h1:lIFcxRox3TwK/9mofn+T0uVxtHV/yiUgqXwC+nrNUms=\n",
+			string(goSum),
+			sid,
+		)
+	}
+}
+
+func (s *ScenarioSuite) TestBeforeRunVcs() {
+	t := s.T()
+
+	rootDir := filepath.Join(testkit_file.DynamicDataDirAbs(t), "vcs")
+	stage := cage_file_stage.NewStage(rootDir)
+
+	config := gomodfuzz.Config{
+		Vcses: []int{
+			gomodfuzz.NoVcs, gomodfuzz.CleanVcs, gomodfuzz.DirtyVcs, gomodfuzz.SubdirVcs, gomodfuzz.UnsafeVcs,
+		},
+		BuildvcsFalse: true,
+	}
+	baseScenario := gomodfuzz.NewScenario(cage_exec.CommonExecutor{}, rootDir, config)
+	permutations := tp_algo.Permute(&baseScenario)
+
+	require.Len(t, permutations, 2*72*len(config.Vcses))
+
+	var goflags []string
+	for _, p := range permutations {
+		scenario := p.(gomodfuzz.Scenario)
+		if scenario.GO111MODULE == "auto" && scenario.GOPATH == gomodfuzz.EmptyGopath && scenario.IN_MODULE &&
+			scenario.WD == gomodfuzz.WdInsideGopath && scenario.VCS == gomodfuzz.NoVcs {
+			goflags = append(goflags, scenario.GOFLAGS)
+		}
+	}
+	require.Exactly(t, []string{"-mod=vendor", "", "-mod=vendor -buildvcs=false", "-buildvcs=false"}, goflags)
+
+	// gitOutput returns the trimmed standard output of a git command which must succeed.
+	gitOutput := func(scenario gomodfuzz.Scenario, args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = scenario.VcsRoot()
+		cmd.Env = append(os.Environ(), "HOME="+scenario.Home(), "GIT_CONFIG_NOSYSTEM=1")
+		out, err := cmd.Output()
+		require.NoError(t, err, scenario.String())
+		return strings.TrimSpace(string(out))
+	}
+
+	for _, scenario := range s.permuteCanonical(cage_exec.CommonExecutor{}, rootDir, config) {
+		sid := scenario.String()
+
+		require.NoError(t, scenario.BeforeRun(stage), sid)
+
+		if scenario.VCS == gomodfuzz.UnsafeVcs {
+			require.Contains(t, scenario.Environ(), "GIT_TEST_ASSUME_DIFFERENT_OWNER=1", sid)
+		} else {
+			require.NotContains(t, scenario.Environ(), "GIT_TEST_ASSUME_DIFFERENT_OWNER=1", sid)
+		}
+
+		switch scenario.VCS {
+		case gomodfuzz.NoVcs:
+			require.Exactly(t, "", scenario.VcsRoot(), sid)
+			exists, _, err := cage_file.Exists(filepath.Join(scenario.Wd(), ".git"))
+			require.NoError(t, err, sid)
+			require.False(t, exists, sid)
+		case gomodfuzz.CleanVcs, gomodfuzz.UnsafeVcs:
+			require.Exactly(t, scenario.Wd(), scenario.VcsRoot(), sid)
+			require.Exactly(t, "", gitOutput(scenario, "status", "--porcelain"), sid)
+			require.Exactly(t, "go.mod\ngomodfuzz_vcs.txt", gitOutput(scenario, "ls-files"), sid)
+		case gomodfuzz.DirtyVcs:
+			require.Exactly(t, scenario.Wd(), scenario.VcsRoot(), sid)
+			require.Exactly(t, "M gomodfuzz_vcs.txt", gitOutput(scenario, "status", "--porcelain"), sid)
+		case gomodfuzz.SubdirVcs:
+			require.Exactly(t, filepath.Dir(scenario.Wd()), scenario.VcsRoot(), sid)
+			require.Exactly(t, "", gitOutput(scenario, "status", "--porcelain"), sid)
+			require.Exactly(t, "wd/go.mod\nwd/gomodfuzz_vcs.txt", gitOutput(scenario, "ls-files"), sid)
+		}
+	}
+}
+
+func (s *ScenarioSuite) TestBeforeRunGoDirectiveAndToolchain() {
+	t := s.T()
+
+	rootDir := filepath.Join(testkit_file.DynamicDataDir(), "go_directive")
+	stage := cage_file_stage.NewStage(rootDir)
+
+	config := gomodfuzz.Config{
+		GoDirectives: []int{gomodfuzz.NoGoDirective, gomodfuzz.Go117GoDirective, gomodfuzz.NewerGoDirective},
+		Toolchains:   []int{gomodfuzz.NoToolchain, gomodfuzz.NewerToolchain, gomodfuzz.NewerLocalToolchain},
+	}
+
+	expectGoDirective := map[int]string{
+		gomodfuzz.NoGoDirective:    "",
+		gomodfuzz.Go117GoDirective: "\ngo 1.17\n",
+		gomodfuzz.NewerGoDirective: "\ngo 1.99\n",
+	}
+	expectToolchain := map[int]string{
+		gomodfuzz.NoToolchain:         "",
+		gomodfuzz.NewerToolchain:      "\ntoolchain go1.99.0\n",
+		gomodfuzz.NewerLocalToolchain: "\ntoolchain go1.99.0\n",
+	}
+	expectGotoolchain := map[int]string{
+		gomodfuzz.NoToolchain:         "auto",
+		gomodfuzz.NewerToolchain:      "auto",
+		gomodfuzz.NewerLocalToolchain: "local",
+	}
+
+	for _, scenario := range s.permuteCanonical(s.executor, rootDir, config) {
+		sid := scenario.String()
+
+		require.NoError(t, scenario.BeforeRun(stage), sid)
+
+		goMod, err := ioutil.ReadFile(filepath.Join(scenario.Wd(), "go.mod"))
+		require.NoError(t, err, sid)
+		require.Exactly(t,
+			"module wd\n"+expectGoDirective[scenario.GO_DIRECTIVE]+expectToolchain[scenario.TOOLCHAIN],
+			string(goMod),
+			sid,
+		)
+
+		require.Contains(t, scenario.Environ(), "GOTOOLCHAIN="+expectGotoolchain[scenario.TOOLCHAIN], sid)
+	}
+}
+
+func (s *ScenarioSuite) TestBeforeRunGoflags() {
+	t := s.T()
+
+	rootDir := filepath.Join(testkit_file.DynamicDataDir(), "goflags")
+	stage := cage_file_stage.NewStage(rootDir)
+
+	config := gomodfuzz.Config{
+		Goflags:        []string{"-mod=mod", "-modfile=alt.mod", "-trimpath"},
+		GoflagsCompose: gomodfuzz.PairGoflags,
+		BuildvcsFalse:  true,
+	}
+	baseScenario := gomodfuzz.NewScenario(s.executor, rootDir, config)
+	permutations := tp_algo.Permute(&baseScenario)
+
+	expectGoflags := []string{
+		"",
+		"-mod=mod",
+		"-modfile=alt.mod",
+		"-trimpath",
+		"-mod=mod -modfile=alt.mod",
+		"-mod=mod -trimpath",
+		"-modfile=alt.mod -trimpath",
+		"-buildvcs=false",
+		"-mod=mod -buildvcs=false",
+		"-modfile=alt.mod -buildvcs=false",
+		"-trimpath -buildvcs=false",
+		"-mod=mod -modfile=alt.mod -buildvcs=false",
+		"-mod=mod -trimpath -buildvcs=false",
+		"-modfile=alt.mod -trimpath -buildvcs=false",
+	}
+
+	require.Len(t, permutations, 3*len(expectGoflags)*3*2*2)
+
+	perGoflags := 3 * 2 * 2 // GOPATH, IN_MODULE, and WD permutations
+	for n, goflags := range expectGoflags {
+		scenario := permutations[n*perGoflags].(gomodfuzz.Scenario)
+		sid := scenario.String()
+
+		require.Exactly(t, goflags, scenario.GOFLAGS, sid)
+		require.True(t, scenario.IN_MODULE, sid)
+		require.NoError(t, scenario.BeforeRun(stage), sid)
+
+		altMod := filepath.Join(scenario.Wd(), "alt.mod")
+		exists, _, err := cage_file.Exists(altMod)
+		require.NoError(t, err, sid)
+
+		if strings.Contains(goflags, "-modfile=alt.mod") {
+			require.Exactly(t, altMod, scenario.Modfile(), sid)
+			require.True(t, exists, sid)
+
+			content, err := ioutil.ReadFile(altMod)
+			require.NoError(t, err, sid)
+			require.Exactly(t, "module wd\n", string(content), sid)
+		} else {
+			require.Exactly(t, "", scenario.Modfile(), sid)
+			require.False(t, exists, sid)
+		}
+	}
+}
+
+func (s *ScenarioSuite) TestUnsetEnv() {
+	t := s.T()
+
+	rootDir := filepath.Join(testkit_file.DynamicDataDirAbs(t), "unset_env")
+	stage := cage_file_stage.NewStage(rootDir)
+
+	config := gomodfuzz.Config{
+		UnsetEnvAxes: true,
+		Goproxies:    []int{gomodfuzz.OffGoproxy, gomodfuzz.UnsetGoproxy},
+		Privates:     []int{gomodfuzz.PublicModules, gomodfuzz.UnsetPrivateModules},
+	}
+	baseScenario := gomodfuzz.NewScenario(cage_exec.CommonExecutor{}, rootDir, config)
+	permutations := tp_algo.Permute(&baseScenario)
+
+	require.Len(t, permutations, 4*3*4*2*2*len(config.Goproxies)*len(config.Privates))
+
+	var unset, empty gomodfuzz.Scenario
+	for _, p := range permutations {
+		scenario := p.(gomodfuzz.Scenario)
+		if scenario.IN_MODULE && scenario.WD == gomodfuzz.WdOutsideGopath {
+			if scenario.GO111MODULE == gomodfuzz.UnsetValue && scenario.GOFLAGS == gomodfuzz.UnsetValue &&
+				scenario.GOPATH == gomodfuzz.UnsetGopath && scenario.GOPROXY == gomodfuzz.UnsetGoproxy &&
+				scenario.PRIVATE == gomodfuzz.UnsetPrivateModules {
+				unset = scenario
+			}
+			if scenario.GO111MODULE == "on" && scenario.GOFLAGS == "" && scenario.GOPATH == gomodfuzz.EmptyGopath &&
+				scenario.GOPROXY == gomodfuzz.OffGoproxy && scenario.PRIVATE == gomodfuzz.PublicModules {
+				empty = scenario
+			}
+		}
+	}
+
+	require.Exactly(t, rootDir, unset.GetRootDir())
+	require.Exactly(t, rootDir, empty.GetRootDir())
+
+	require.Exactly(t,
+		[]string{"GO111MODULE", "GOFLAGS", "GOPATH", "GOPROXY", "GOPRIVATE", "GONOSUMDB", "GOINSECURE"},
+		unset.Unsetenv(),
+	)
+	require.Empty(t, empty.Unsetenv())
+	require.Contains(t, unset.String(), "GO111MODULE=<unset> GOFLAGS=<unset> GOPATH=<unset> ")
+	require.Exactly(t, gomodfuzz.UnsetValue, unset.AxisLabels()["GOPATH"])
+
+	// Host values must not be inherited by unset variables, and assigned variables must not be duplicated.
+
+	for _, name := range []string{"GO111MODULE", "GOFLAGS", "GOPATH", "GOPROXY", "GOPRIVATE", "HOME"} {
+		original, ok := os.LookupEnv(name)
+		require.NoError(t, os.Setenv(name, "host_value"))
+		if ok {
+			defer os.Setenv(name, original)
+		} else {
+			defer os.Unsetenv(name)
+		}
+	}
+
+	for _, scenario := range []gomodfuzz.Scenario{unset, empty} {
+		sid := scenario.String()
+
+		require.NoError(t, scenario.BeforeRun(stage), sid)
+		res, err := scenario.Run(context.Background(), []string{"env"})
+		require.NoError(t, err, sid)
+		require.NoError(t, res.Err, sid)
+
+		environ := strings.Split(res.Stdout, "\n")
+		names := map[string]int{}
+		for _, pair := range environ {
+			names[strings.SplitN(pair, "=", 2)[0]]++
+		}
+		for name, count := range names {
+			require.Exactly(t, 1, count, sid+" "+name)
+		}
+
+		require.Contains(t, environ, "HOME="+scenario.Home(), sid)
+		if scenario.GOFLAGS == gomodfuzz.UnsetValue {
+			for _, name := range scenario.Unsetenv() {
+				require.NotContains(t, names, name, sid)
+			}
+		} else {
+			require.Contains(t, environ, "GO111MODULE=on", sid)
+			require.Contains(t, environ, "GOFLAGS=", sid)
+			require.Contains(t, environ, "GOPATH=", sid)
+			require.Contains(t, environ, "GOPROXY=off", sid)
+			require.Contains(t, environ, "GOPRIVATE=", sid)
+		}
+	}
+}
+
+func (s *ScenarioSuite) TestRunHermetic() {
+	t := s.T()
+
+	rootDir := filepath.Join(testkit_file.DynamicDataDirAbs(t), "hermetic")
+	stage := cage_file_stage.NewStage(rootDir)
+
+	for _, name := range []string{"GOMODFUZZ_TEST_PASS", "GOMODFUZZ_TEST_DROP"} {
+		require.NoError(t, os.Setenv(name, "host_value"))
+		defer os.Unsetenv(name)
+	}
+
+	config := gomodfuzz.Config{Hermetic: true, PassEnv: []string{"GOMODFUZZ_TEST_PASS"}}
+	baseScenario := gomodfuzz.NewScenario(cage_exec.CommonExecutor{}, rootDir, config)
+	scenario := tp_algo.Permute(&baseScenario)[0].(gomodfuzz.Scenario)
+	sid := scenario.String()
+
+	require.NoError(t, scenario.BeforeRun(stage), sid)
+	res, err := scenario.Run(context.Background(), []string{"env"})
+	require.NoError(t, err, sid)
+	require.NoError(t, res.Err, sid)
+
+	environ := strings.Split(res.Stdout, "\n")
+	require.Contains(t, environ, "PATH="+os.Getenv("PATH"), sid)
+	require.Contains(t, environ, "HOME="+scenario.Home(), sid)
+	require.Contains(t, environ, "GOMODFUZZ_TEST_PASS=host_value", sid)
+	require.NotContains(t, environ, "GOMODFUZZ_TEST_DROP=host_value", sid)
+
+	require.Contains(t, res.DroppedEnv, "GOMODFUZZ_TEST_DROP", sid)
+	require.NotContains(t, res.DroppedEnv, "GOMODFUZZ_TEST_PASS", sid)
+	require.NotContains(t, res.DroppedEnv, "PATH", sid)
+}
+
+func (s *ScenarioSuite) TestRunWithHostEnv() {
+	t := s.T()
+
+	rootDir := filepath.Join(testkit_file.DynamicDataDirAbs(t), "with_host_env")
+	stage := cage_file_stage.NewStage(rootDir)
+
+	require.NoError(t, os.Setenv("GOMODFUZZ_TEST_OS", "host_value"))
+	defer os.Unsetenv("GOMODFUZZ_TEST_OS")
+
+	baseScenario := gomodfuzz.NewScenario(cage_exec.CommonExecutor{}, rootDir)
+	scenario := tp_algo.Permute(&baseScenario)[0].(gomodfuzz.Scenario)
+	scenario = scenario.WithHostEnv([]string{"PATH=" + os.Getenv("PATH"), "GOMODFUZZ_TEST_CUSTOM=custom_value"})
+	sid := scenario.String()
+
+	require.NoError(t, scenario.BeforeRun(stage), sid)
+	res, err := scenario.Run(context.Background(), []string{"env"})
+	require.NoError(t, err, sid)
+	require.NoError(t, res.Err, sid)
+
+	environ := strings.Split(res.Stdout, "\n")
+	require.Contains(t, environ, "GOMODFUZZ_TEST_CUSTOM=custom_value", sid)
+	require.NotContains(t, environ, "GOMODFUZZ_TEST_OS=host_value", sid)
+}
+
+func (s *ScenarioSuite) TestBeforeRunPathShape() {
+	t := s.T()
+
+	rootDir := filepath.Join(testkit_file.DynamicDataDirAbs(t), "path_shape")
+	stage := cage_file_stage.NewStage(rootDir)
+
+	config := gomodfuzz.Config{
+		PathShapes: []int{
+			gomodfuzz.PlainPathShape, gomodfuzz.SpacesPathShape, gomodfuzz.UnicodePathShape,
+			gomodfuzz.SymlinkWdPathShape, gomodfuzz.SymlinkGopathPathShape, gomodfuzz.LongPathShape,
+		},
+	}
+	baseScenario := gomodfuzz.NewScenario(s.executor, rootDir, config)
+	permutations := tp_algo.Permute(&baseScenario)
+
+	require.Len(t, permutations, 72*len(config.PathShapes))
+
+	var checked int
+	for _, p := range permutations {
+		scenario := p.(gomodfuzz.Scenario)
+		if scenario.GOPATH != gomodfuzz.UsableGopath || !scenario.IN_MODULE || scenario.WD != gomodfuzz.WdInsideGopath ||
+			scenario.GO111MODULE != "on" || scenario.GOFLAGS != "" {
+			continue
+		}
+		checked++
+		sid := scenario.String()
+
+		require.NoError(t, scenario.BeforeRun(stage), sid)
+
+		_, err := os.Stat(filepath.Join(scenario.Wd(), "go.mod"))
+		require.NoError(t, err, sid)
+
+		realWd, err := filepath.EvalSymlinks(scenario.Wd())
+		require.NoError(t, err, sid)
+		realGopath, err := filepath.EvalSymlinks(scenario.Gopath())
+		require.NoError(t, err, sid)
+
+		require.Exactly(t, scenario.RealWd(), realWd, sid)
+		require.Contains(t, scenario.Environ(), "GOPATH="+scenario.Gopath(), sid)
+
+		switch scenario.PATH_SHAPE {
+		case gomodfuzz.PlainPathShape:
+			require.Exactly(t, filepath.Join(rootDir, strconv.Itoa(scenario.Id())), scenario.ScenarioDir(), sid)
+			require.Exactly(t, scenario.Wd(), realWd, sid)
+			require.Exactly(t, scenario.Gopath(), realGopath, sid)
+		case gomodfuzz.SpacesPathShape:
+			require.Contains(t, scenario.Wd(), " ", sid)
+			require.Contains(t, scenario.Gopath(), " ", sid)
+		case gomodfuzz.UnicodePathShape:
+			require.Contains(t, scenario.Wd(), "ü", sid)
+			require.Contains(t, scenario.Gopath(), "ü", sid)
+		case gomodfuzz.SymlinkWdPathShape:
+			require.NotEqual(t, scenario.Wd(), realWd, sid)
+			require.Exactly(t, scenario.Gopath(), realGopath, sid)
+		case gomodfuzz.SymlinkGopathPathShape:
+			require.Exactly(t, scenario.Wd(), realWd, sid)
+			require.Exactly(t, scenario.UsableGopath(), realGopath, sid)
+			require.NotEqual(t, scenario.Gopath(), realGopath, sid)
+		case gomodfuzz.LongPathShape:
+			require.True(t, len(scenario.ScenarioDir()) >= 3584, sid)
+			require.True(t, len(filepath.Join(scenario.Wd(), "go.mod")) < 4096, sid)
+		}
+	}
+	require.Exactly(t, len(config.PathShapes), checked)
+}
+
+func (s *ScenarioSuite) TestRunSpecialDir() {
+	t := s.T()
+
+	rootDir := filepath.Join(testkit_file.DynamicDataDirAbs(t), "special_dir")
+	stage := cage_file_stage.NewStage(rootDir)
+
+	config := gomodfuzz.Config{
+		SpecialDirs: []int{
+			gomodfuzz.NoSpecialDir, gomodfuzz.PackageSpecialDir, gomodfuzz.TestdataSpecialDir,
+			gomodfuzz.UnderscoreSpecialDir, gomodfuzz.DotSpecialDir, gomodfuzz.VendorSpecialDir,
+		},
+	}
+	for _, scenario := range s.permuteCanonical(cage_exec.CommonExecutor{}, rootDir, config) {
+		sid := scenario.String()
+
+		require.NoError(t, scenario.BeforeRun(stage), sid)
+
+		res, err := scenario.Run(context.Background(), []string{"pwd"})
+		require.NoError(t, err, sid)
+		require.NoError(t, res.Err, sid)
+		require.Exactly(t, scenario.Wd(), strings.TrimSpace(res.Stdout), sid)
+		require.Exactly(t, filepath.Join(scenario.ModuleRoot(), "go.mod"), res.GoMod, sid)
+
+		_, err = os.Stat(filepath.Join(scenario.Wd(), "special.go"))
+		if scenario.SPECIAL_DIR == gomodfuzz.NoSpecialDir {
+			require.Exactly(t, scenario.ModuleRoot(), scenario.Wd(), sid)
+			require.True(t, os.IsNotExist(err), sid)
+		} else {
+			require.Exactly(t, scenario.ModuleRoot(), filepath.Dir(scenario.Wd()), sid)
+			require.Exactly(t, gomodfuzz.ModeName("SPECIAL_DIR", scenario.SPECIAL_DIR), filepath.Base(scenario.Wd()), sid)
+			require.NoError(t, err, sid)
+		}
+	}
+}
+
+func (s *ScenarioSuite) TestRunNestedModule() {
+	t := s.T()
+
+	rootDir := filepath.Join(testkit_file.DynamicDataDirAbs(t), "nested_module")
+	stage := cage_file_stage.NewStage(rootDir)
+
+	config := gomodfuzz.Config{
+		NestedModules: []int{
+			gomodfuzz.NoNestedModule, gomodfuzz.InsideNestedModule, gomodfuzz.ParentNestedModule, gomodfuzz.ReplacedNestedModule,
+		},
+	}
+	for _, scenario := range s.permuteCanonical(cage_exec.CommonExecutor{}, rootDir, config) {
+		sid := scenario.String()
+
+		require.NoError(t, scenario.BeforeRun(stage), sid)
+
+		res, err := scenario.Run(context.Background(), []string{"go", "list", "-m"})
+		require.NoError(t, err, sid)
+		require.NoError(t, res.Err, sid)
+
+		goMod, err := ioutil.ReadFile(filepath.Join(scenario.ModuleRoot(), "go.mod"))
+		require.NoError(t, err, sid)
+
+		switch scenario.NESTED_MODULE {
+		case gomodfuzz.NoNestedModule:
+			require.Exactly(t, "", scenario.NestedModuleDir(), sid)
+			require.Exactly(t, scenario.ModuleRoot(), scenario.Wd(), sid)
+			require.Exactly(t, filepath.Join(scenario.ModuleRoot(), "go.mod"), res.GoMod, sid)
+		case gomodfuzz.ParentNestedModule:
+			require.Exactly(t, scenario.ModuleRoot(), scenario.Wd(), sid)
+			require.Exactly(t, filepath.Join(scenario.ModuleRoot(), "go.mod"), res.GoMod, sid)
+			require.Exactly(t, scenario.ModulePath(), strings.TrimSpace(res.Stdout), sid)
+		case gomodfuzz.InsideNestedModule, gomodfuzz.ReplacedNestedModule:
+			require.Exactly(t, scenario.NestedModuleDir(), scenario.Wd(), sid)
+			require.Exactly(t, filepath.Join(scenario.NestedModuleDir(), "go.mod"), res.GoMod, sid)
+			require.Exactly(t, scenario.NestedModulePath(), strings.TrimSpace(res.Stdout), sid)
+		}
+
+		if scenario.NESTED_MODULE == gomodfuzz.ReplacedNestedModule {
+			require.Contains(t, string(goMod), "replace "+scenario.NestedModulePath()+" => ./sub\n", sid)
+		} else {
+			require.NotContains(t, string(goMod), "replace", sid)
+		}
+	}
+}
+
+func (s *ScenarioSuite) TestBeforeRunModDirective() {
+	t := s.T()
+
+	rootDir := filepath.Join(testkit_file.DynamicDataDirAbs(t), "mod_directive")
+	stage := cage_file_stage.NewStage(rootDir)
+
+	mods, err := gomodfuzz.LoadFixtureModules(filepath.Join(testkit_file.FixtureDataDir(), "modules"))
+	require.NoError(t, err)
+
+	config := gomodfuzz.Config{
+		FixtureModules: mods,
+		ModDirectives: []int{
+			gomodfuzz.NoModDirective, gomodfuzz.ReplaceRelativeModDirective, gomodfuzz.ReplaceAbsoluteModDirective,
+			gomodfuzz.ReplaceVersionModDirective, gomodfuzz.ExcludeModDirective, gomodfuzz.RetractModDirective,
+		},
+	}
+
+	const requireDep = "module wd\n\nrequire (\n\tgomodfuzz.test/dep v1.0.0\n)\n"
+	const requireLocal = "module wd\n\nrequire (\n\tgomodfuzz.test/dep v1.0.0\n\texample.com/gomodfuzz/dep v0.0.0\n)\n"
+
+	for _, scenario := range s.permuteCanonical(s.executor, rootDir, config) {
+		sid := scenario.String()
+
+		require.NoError(t, scenario.BeforeRun(stage), sid)
+
+		goMod, err := ioutil.ReadFile(filepath.Join(scenario.Wd(), "go.mod"))
+		require.NoError(t, err, sid)
+
+		_, localErr := os.Stat(filepath.Join(scenario.LocalDepDir(), "go.mod"))
+
+		switch scenario.MOD_DIRECTIVE {
+		case gomodfuzz.NoModDirective:
+			require.Exactly(t, requireDep, string(goMod), sid)
+		case gomodfuzz.ReplaceRelativeModDirective:
+			require.Exactly(t, requireLocal+"\nreplace example.com/gomodfuzz/dep => ../dep\n", string(goMod), sid)
+			require.NoError(t, localErr, sid)
+		case gomodfuzz.ReplaceAbsoluteModDirective:
+			require.Exactly(t, requireLocal+"\nreplace example.com/gomodfuzz/dep => \""+scenario.LocalDepDir()+"\"\n", string(goMod), sid)
+			require.NoError(t, localErr, sid)
+		case gomodfuzz.ReplaceVersionModDirective:
+			require.Exactly(t, requireDep+"\nreplace gomodfuzz.test/dep v1.0.0 => gomodfuzz.test/dep v1.1.0\n", string(goMod), sid)
+		case gomodfuzz.ExcludeModDirective:
+			require.Exactly(t, requireDep+"\nexclude gomodfuzz.test/dep v1.0.0\n", string(goMod), sid)
+		case gomodfuzz.RetractModDirective:
+			require.Exactly(t, requireDep+"\nretract v0.1.0\n", string(goMod), sid)
+		}
+
+		if scenario.MOD_DIRECTIVE != gomodfuzz.ReplaceRelativeModDirective && scenario.MOD_DIRECTIVE != gomodfuzz.ReplaceAbsoluteModDirective {
+			require.True(t, os.IsNotExist(localErr), sid)
+		}
+	}
+}
+
+func (s *ScenarioSuite) TestRunMajorVersion() {
+	t := s.T()
+
+	rootDir := filepath.Join(testkit_file.DynamicDataDirAbs(t), "major_version")
+	stage := cage_file_stage.NewStage(rootDir)
+
+	var mods []gomodfuzz.FixtureModule
+	for _, dir := range []string{"modules", "modules_v2"} {
+		dirMods, err := gomodfuzz.LoadFixtureModules(filepath.Join(testkit_file.FixtureDataDir(), dir))
+		require.NoError(t, err)
+		mods = append(mods, dirMods...)
+	}
+
+	config := gomodfuzz.Config{
+		Layouts:        []int{gomodfuzz.GopathSrcLayout},
+		FixtureModules: mods,
+		Goproxies:      []int{gomodfuzz.FileGoproxy},
+		Privates:       []int{gomodfuzz.GonosumdbModules},
+		Goflags:        []string{"-mod=mod"},
+		MajorVersions: []int{
+			gomodfuzz.NoMajorVersion, gomodfuzz.SubdirMajorVersion, gomodfuzz.BranchMajorVersion, gomodfuzz.DepMajorVersion,
+		},
+	}
+	baseScenario := gomodfuzz.NewScenario(cage_exec.CommonExecutor{}, rootDir, config)
+	require.NoError(t, gomodfuzz.WriteProxyTree(mods, baseScenario.FileProxyDir()))
+	permutations := gomodfuzz.Permute(&baseScenario)
+
+	require.Len(t, permutations, 12*len(config.MajorVersions))
+
+	importPath := gomodfuzz.DefaultImportPath
+	expectImportPath := map[bool]map[int]string{
+		true: { // module mode
+			gomodfuzz.NoMajorVersion:     importPath,
+			gomodfuzz.SubdirMajorVersion: importPath + "/v2",
+			gomodfuzz.BranchMajorVersion: importPath + "/v2",
+			gomodfuzz.DepMajorVersion:    importPath,
+		},
+		false: { // GOPATH mode resolves import paths from directories
+			gomodfuzz.NoMajorVersion:     importPath,
+			gomodfuzz.SubdirMajorVersion: importPath + "/v2",
+			gomodfuzz.BranchMajorVersion: importPath,
+			gomodfuzz.DepMajorVersion:    importPath,
+		},
+	}
+
+	var checked int
+	for _, scenario := range permutations {
+		if !scenario.IN_MODULE {
+			continue
+		}
+		moduleMode := scenario.GO111MODULE == "on" && scenario.GOFLAGS == "-mod=mod"
+		if !moduleMode && (scenario.GO111MODULE != "off" || scenario.GOFLAGS != "") {
+			continue
+		}
+		checked++
+		sid := scenario.String()
+
+		require.NoError(t, scenario.BeforeRun(stage), sid)
+
+		res, err := scenario.Run(context.Background(), []string{"go", "list", "-e", "-deps", "-f", "{{.ImportPath}}", "."})
+		require.NoError(t, err, sid)
+
+		lines := strings.Split(strings.TrimSpace(res.Stdout), "\n")
+		require.Exactly(t, expectImportPath[moduleMode][scenario.MAJOR_VERSION], lines[len(lines)-1], sid+" "+res.Stderr)
+
+		if moduleMode {
+			require.NoError(t, res.Err, sid)
+			require.Exactly(t, 0, res.Code, sid+" "+res.Stderr)
+			if scenario.MAJOR_VERSION == gomodfuzz.DepMajorVersion {
+				require.Contains(t, lines, "gomodfuzz.test/dep/v2", sid)
+			}
+		}
+	}
+	require.Exactly(t, 2*len(config.MajorVersions), checked)
+}
+
+func (s *ScenarioSuite) TestBeforeRunGosum() {
+	t := s.T()
+
+	rootDir := filepath.Join(testkit_file.DynamicDataDirAbs(t), "gosum")
+	stage := cage_file_stage.NewStage(rootDir)
+
+	mods, err := gomodfuzz.LoadFixtureModules(filepath.Join(testkit_file.FixtureDataDir(), "modules"))
+	require.NoError(t, err)
+
+	zipHash, err := mods[0].ZipHash()
+	require.NoError(t, err)
+	goModHash, err := mods[0].GoModHash()
+	require.NoError(t, err)
+
+	config := gomodfuzz.Config{
+		FixtureModules: mods,
+		Gosums:         []int{gomodfuzz.NoGosum, gomodfuzz.CompleteGosum, gomodfuzz.MissingEntryGosum, gomodfuzz.WrongHashGosum},
+	}
+
+	zipLine := "gomodfuzz.test/dep v1.0.0 " + zipHash + "\n"
+	expectGosum := map[int]string{
+		gomodfuzz.CompleteGosum:     zipLine + "gomodfuzz.test/dep v1.0.0/go.mod " + goModHash + "\n",
+		gomodfuzz.MissingEntryGosum: zipLine,
+		gomodfuzz.WrongHashGosum:    zipLine + "gomodfuzz.test/dep v1.0.0/go.mod h1:47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=\n",
+	}
+
+	for _, scenario := range s.permuteCanonical(s.executor, rootDir, config) {
+		sid := scenario.String()
+
+		require.NoError(t, scenario.BeforeRun(stage), sid)
+
+		goSum, err := ioutil.ReadFile(filepath.Join(scenario.Wd(), "go.sum"))
+		if scenario.GOSUM == gomodfuzz.NoGosum {
+			require.True(t, os.IsNotExist(err), sid)
+			continue
+		}
+		require.NoError(t, err, sid)
+		require.Exactly(t, expectGosum[scenario.GOSUM], string(goSum), sid)
+	}
+}
+
+func (s *ScenarioSuite) TestRunMalformedGomod() {
+	t := s.T()
+
+	rootDir := filepath.Join(testkit_file.DynamicDataDirAbs(t), "malformed_gomod")
+	stage := cage_file_stage.NewStage(rootDir)
+
+	config := gomodfuzz.Config{
+		Goproxies: []int{gomodfuzz.OffGoproxy},
+		MalformedGomods: []int{
+			gomodfuzz.NoMalformedGomod, gomodfuzz.SyntaxMalformedGomod, gomodfuzz.NoModuleMalformedGomod,
+			gomodfuzz.UnknownDirectiveMalformedGomod, gomodfuzz.DuplicateRequireMalformedGomod, gomodfuzz.InvalidGoMalformedGomod,
+		},
+	}
+
+	expectStderr := map[int]string{
+		gomodfuzz.SyntaxMalformedGomod:           "unterminated block",
+		gomodfuzz.NoModuleMalformedGomod:         "missing module declaration",
+		gomodfuzz.UnknownDirectiveMalformedGomod: "unknown directive: frobnicate",
+		gomodfuzz.DuplicateRequireMalformedGomod: "example.com/gomodfuzz/dup",
+		gomodfuzz.InvalidGoMalformedGomod:        "invalid go version '1.x'",
+	}
+
+	for _, scenario := range s.permuteCanonical(cage_exec.CommonExecutor{}, rootDir, config) {
+		sid := scenario.String()
+
+		require.NoError(t, scenario.BeforeRun(stage), sid)
+
+		res, err := scenario.Run(context.Background(), []string{"go", "list", "-m", "all"})
+		require.NoError(t, err, sid)
+
+		if scenario.MALFORMED_GOMOD == gomodfuzz.NoMalformedGomod {
+			require.Exactly(t, gomodfuzz.PassOutcome, res.Outcome, sid)
+			continue
+		}
+
+		// `go env` does not parse go.mod, so the subject runs and reports the malformed file itself.
+		require.Exactly(t, gomodfuzz.ErrorOutcome, res.Outcome, sid)
+		require.Exactly(t, 1, res.Code, sid)
+		require.Contains(t, res.Stderr, expectStderr[scenario.MALFORMED_GOMOD], sid)
+	}
+}
+
+func (s *ScenarioSuite) TestRunUnavailableToolchain() {
+	t := s.T()
+
+	rootDir := filepath.Join(testkit_file.DynamicDataDirAbs(t), "unavailable_toolchain")
+	stage := cage_file_stage.NewStage(rootDir)
+
+	config := gomodfuzz.Config{
+		Goproxies:  []int{gomodfuzz.OffGoproxy},
+		Toolchains: []int{gomodfuzz.NoToolchain, gomodfuzz.NewerToolchain, gomodfuzz.NewerLocalToolchain},
+	}
+
+	expectOutcome := map[int]int{
+		gomodfuzz.NoToolchain:         gomodfuzz.PassOutcome,
+		gomodfuzz.NewerToolchain:      gomodfuzz.EnvErrorOutcome, // `go env` cannot switch to the toolchain
+		gomodfuzz.NewerLocalToolchain: gomodfuzz.PassOutcome,
+	}
+
+	for _, scenario := range s.permuteCanonical(cage_exec.CommonExecutor{}, rootDir, config) {
+		sid := scenario.String()
+
+		require.NoError(t, scenario.BeforeRun(stage), sid)
+
+		res, err := scenario.Run(context.Background(), []string{"go", "list", "-m"})
+		require.NoError(t, err, sid)
+		require.Exactly(t, expectOutcome[scenario.TOOLCHAIN], res.Outcome, sid+" "+res.Stderr)
+
+		if res.Outcome == gomodfuzz.EnvErrorOutcome {
+			require.Exactly(t, -1, res.Code, sid)
+			require.Empty(t, res.Stdout, sid)
+			testkit_require.StringContains(t, res.Err.Error(), "failed to run 'go env'", "go1.99.0")
+		}
+	}
+}
+
+func (s *ScenarioSuite) TestRunOutcome() {
+	t := s.T()
+
+	rootDir := filepath.Join(testkit_file.DynamicDataDirAbs(t), "outcome")
+	stage := cage_file_stage.NewStage(rootDir)
+
+	baseScenario := gomodfuzz.NewScenario(cage_exec.CommonExecutor{}, rootDir)
+	scenario := tp_algo.Permute(&baseScenario)[0].(gomodfuzz.Scenario)
+	sid := scenario.String()
+
+	require.NoError(t, scenario.BeforeRun(stage), sid)
+
+	cases := []struct {
+		args    []string
+		timeout time.Duration
+		expect  int
+	}{
+		{args: []string{"true"}, expect: gomodfuzz.PassOutcome},
+		{args: []string{"sh", "-c", "echo 'invalid input' >&2; exit 1"}, expect: gomodfuzz.ErrorOutcome},
+		{args: []string{"sh", "-c", "printf 'panic: boom\\n\\ngoroutine 1 [running]:\\nmain.main()\\n' >&2; exit 2"}, expect: gomodfuzz.PanicOutcome},
+		{args: []string{"sleep", "10"}, timeout: 2 * time.Second, expect: gomodfuzz.TimeoutOutcome},
+	}
+
+	for _, c := range cases {
+		ctx := context.Background()
+		if c.timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, c.timeout)
+			defer cancel()
+		}
+
+		res, err := scenario.Run(ctx, c.args)
+		require.NoError(t, err, sid)
+		require.Exactly(t, gomodfuzz.OutcomeName(c.expect), gomodfuzz.OutcomeName(res.Outcome), strings.Join(c.args, " "))
+	}
+}
+
+func (s *ScenarioSuite) TestRunInvalidEnv() {
+	t := s.T()
+
+	rootDir := filepath.Join(testkit_file.DynamicDataDirAbs(t), "invalid_env")
+	stage := cage_file_stage.NewStage(rootDir)
+
+	goroot, err := exec.Command("go", "env", "GOROOT").Output()
+	require.NoError(t, err)
+
+	config := gomodfuzz.Config{InvalidEnvAxes: true, Goroot: strings.TrimSpace(string(goroot))}
+	baseScenario := gomodfuzz.NewScenario(cage_exec.CommonExecutor{}, rootDir, config)
+	permutations := tp_algo.Permute(&baseScenario)
+
+	require.Len(t, permutations, 4*3*6*2*2)
+
+	var checked int
+	for _, p := range permutations {
+		scenario := p.(gomodfuzz.Scenario)
+		if !scenario.IN_MODULE || scenario.WD != gomodfuzz.WdOutsideGopath {
+			continue
+		}
+
+		// Select scenarios which have exactly one invalid value.
+		var invalid int
+		if scenario.GO111MODULE == gomodfuzz.InvalidGo111module {
+			invalid++
+		} else if scenario.GO111MODULE != "on" {
+			continue
+		}
+		if scenario.GOFLAGS == gomodfuzz.InvalidGoflags {
+			invalid++
+		} else if scenario.GOFLAGS != "" {
+			continue
+		}
+		if scenario.GOPATH > gomodfuzz.UnsetGopath {
+			invalid++
+		} else if scenario.GOPATH != gomodfuzz.UsableGopath {
+			continue
+		}
+		if invalid != 1 {
+			continue
+		}
+		checked++
+		sid := scenario.String()
+
+		require.NoError(t, scenario.BeforeRun(stage), sid)
+
+		res, err := scenario.Run(context.Background(), []string{"go", "list", "-m"})
+		require.NoError(t, err, sid)
+
+		switch {
+		case scenario.GO111MODULE == gomodfuzz.InvalidGo111module:
+			require.Exactly(t, gomodfuzz.EnvErrorOutcome, res.Outcome, sid)
+			require.Contains(t, res.Err.Error(), "GO111MODULE=yes", sid)
+		case scenario.GOFLAGS == gomodfuzz.InvalidGoflags:
+			require.Exactly(t, gomodfuzz.ErrorOutcome, res.Outcome, sid)
+			require.Contains(t, res.Stderr, "unknown flag -bogus", sid)
+		case scenario.GOPATH == gomodfuzz.RelativeGopath:
+			require.Exactly(t, gomodfuzz.EnvErrorOutcome, res.Outcome, sid)
+			require.Contains(t, res.Err.Error(), "GOPATH entry is relative", sid)
+		case scenario.GOPATH == gomodfuzz.GorootGopath:
+			// The go command only warns about the GOPATH, so the subject's own outcome is reported.
+			require.Exactly(t, gomodfuzz.PassOutcome, res.Outcome, sid)
+			require.Contains(t, scenario.Environ(), "GOPATH="+config.Goroot, sid)
+			require.Contains(t, res.Stderr, "both GOPATH and GOROOT are the same directory", sid)
+		case scenario.GOPATH == gomodfuzz.FileGopath:
+			// `go list -m` does not read the module cache under GOPATH, so the subject passes.
+			require.Exactly(t, gomodfuzz.PassOutcome, res.Outcome, sid)
+			fi, statErr := os.Stat(scenario.Gopath())
+			require.NoError(t, statErr, sid)
+			require.True(t, fi.Mode().IsRegular(), sid)
+		}
+	}
+	require.Exactly(t, 5, checked)
+}
+
+func (s *ScenarioSuite) TestRunPlatformAndCgo() {
+	t := s.T()
+
+	rootDir := filepath.Join(testkit_file.DynamicDataDirAbs(t), "platform")
+	stage := cage_file_stage.NewStage(rootDir)
+
+	config := gomodfuzz.Config{
+		Platforms: []int{
+			gomodfuzz.HostPlatform, gomodfuzz.LinuxAmd64Platform, gomodfuzz.WindowsAmd64Platform, gomodfuzz.DarwinArm64Platform,
+		},
+		Cgos: []int{gomodfuzz.EnabledCgo, gomodfuzz.DisabledCgo},
+	}
+
+	for _, scenario := range s.permuteCanonical(cage_exec.CommonExecutor{}, rootDir, config) {
+		sid := scenario.String()
+
+		require.NoError(t, scenario.BeforeRun(stage), sid)
+
+		res, err := scenario.Run(context.Background(), []string{"go", "list", "-f", "{{join .GoFiles \",\"}}|{{join .CgoFiles \",\"}}", "."})
+		require.NoError(t, err, sid)
+		require.NoError(t, res.Err, sid+" "+res.Stderr)
+
+		goos, goarch := scenario.Platform()
+		if scenario.PLATFORM == gomodfuzz.HostPlatform {
+			require.Exactly(t, "", goarch, sid)
+			goos = runtime.GOOS
+		} else {
+			require.Contains(t, scenario.Environ(), "GOOS="+goos, sid)
+			require.Contains(t, scenario.Environ(), "GOARCH="+goarch, sid)
+		}
+
+		goFiles := []string{"platform.go", "platform_" + goos + ".go"}
+		cgoFiles := "platform_cgo.go"
+		if scenario.CGO == gomodfuzz.DisabledCgo {
+			require.Contains(t, scenario.Environ(), "CGO_ENABLED=0", sid)
+			goFiles = append(goFiles, "platform_nocgo.go")
+			cgoFiles = ""
+		}
+		sort.Strings(goFiles)
+		require.Exactly(t, strings.Join(goFiles, ",")+"|"+cgoFiles, res.Stdout, sid)
+	}
+}
+
+func (s *ScenarioSuite) TestRunReadOnly() {
+	t := s.T()
+
+	rootDir := filepath.Join(testkit_file.DynamicDataDirAbs(t), "read_only")
+	stage := cage_file_stage.NewStage(rootDir)
+
+	config := gomodfuzz.Config{
+		Modcaches: []int{gomodfuzz.EmptyModcache},
+		ReadOnlys: []int{gomodfuzz.WdReadOnly, gomodfuzz.ModuleRootReadOnly, gomodfuzz.GopathReadOnly, gomodfuzz.ModcacheReadOnly},
+	}
+
+	for _, scenario := range s.permuteCanonical(cage_exec.CommonExecutor{}, rootDir, config) {
+		sid := scenario.String()
+
+		dir := map[int]string{
+			gomodfuzz.WdReadOnly:         scenario.Wd(),
+			gomodfuzz.ModuleRootReadOnly: scenario.ModuleRoot(),
+			gomodfuzz.GopathReadOnly:     scenario.Gopath(),
+			gomodfuzz.ModcacheReadOnly:   scenario.Gomodcache(),
+		}[scenario.READ_ONLY]
+
+		require.NoError(t, scenario.BeforeRun(stage), sid)
+
+		info, err := os.Stat(dir)
+		require.NoError(t, err, sid)
+		require.Exactly(t, os.FileMode(0555), info.Mode().Perm(), sid)
+
+		// Write the same file regardless of mode so that only enforcement of permissions varies.
+		res, err := scenario.Run(context.Background(), []string{"sh", "-c", `touch "$0/written"`, dir})
+		require.NoError(t, err, sid)
+
+		if os.Geteuid() == 0 {
+			require.Exactly(t, gomodfuzz.PassOutcome, res.Outcome, sid+" "+res.Stderr)
+			require.Exactly(t, []string{"written"}, res.ReadOnlyWrites, sid)
+		} else {
+			require.Exactly(t, gomodfuzz.ErrorOutcome, res.Outcome, sid)
+			require.Contains(t, res.Stderr, "Permission denied", sid)
+			require.Empty(t, res.ReadOnlyWrites, sid)
+		}
+
+		require.NoError(t, cage_file.RemoveAllSafer(testkit_filepath.Abs(t, scenario.ScenarioDir())), sid)
+	}
+}
+
+func (s *ScenarioSuite) TestRunTty() {
+	t := s.T()
+
+	rootDir := filepath.Join(testkit_file.DynamicDataDirAbs(t), "tty")
+	stage := cage_file_stage.NewStage(rootDir)
+
+	config := gomodfuzz.Config{Ttys: []int{gomodfuzz.PipeTty, gomodfuzz.PtyTty}}
+
+	for _, scenario := range s.permuteCanonical(cage_exec.CommonExecutor{}, rootDir, config) {
+		sid := scenario.String()
+
+		require.NoError(t, scenario.BeforeRun(stage), sid)
+
+		script := `if test -t 0 && test -t 1; then echo terminal; else echo pipe; fi; echo "$PWD" >&2; exit 3`
+		res, err := scenario.Run(context.Background(), []string{"sh", "-c", script})
+		require.NoError(t, err, sid)
+		require.Exactly(t, 3, res.Code, sid)
+		require.Exactly(t, gomodfuzz.ErrorOutcome, res.Outcome, sid)
+
+		if scenario.TTY == gomodfuzz.PtyTty {
+			require.Exactly(t, "terminal\n"+scenario.Wd(), res.Transcript, sid)
+			require.Empty(t, res.Stdout, sid)
+			require.Empty(t, res.Stderr, sid)
+		} else {
+			require.Exactly(t, "pipe", res.Stdout, sid)
+			require.Exactly(t, scenario.Wd(), res.Stderr, sid)
+			require.Empty(t, res.Transcript, sid)
+		}
+	}
+}
+
+func (s *ScenarioSuite) TestRunPattern() {
+	t := s.T()
+
+	rootDir := filepath.Join(testkit_file.DynamicDataDirAbs(t), "pattern")
+	stage := cage_file_stage.NewStage(rootDir)
+
+	config := gomodfuzz.Config{
+		// Give the working directory a package to name.
+		SpecialDirs: []int{gomodfuzz.PackageSpecialDir},
+		Patterns: []int{
+			gomodfuzz.DotPattern, gomodfuzz.DotRecursivePattern, gomodfuzz.ImportPathPattern,
+			gomodfuzz.AbsDirPattern, gomodfuzz.RelDirPattern,
+		},
+	}
+
+	expectedPatterns := map[int]string{
+		gomodfuzz.DotPattern:          ".",
+		gomodfuzz.DotRecursivePattern: "./...",
+		gomodfuzz.ImportPathPattern:   "wd/pkg",
+		gomodfuzz.RelDirPattern:       "../pkg",
+	}
+
+	for _, scenario := range s.permuteCanonical(cage_exec.CommonExecutor{}, rootDir, config) {
+		sid := scenario.String()
+
+		expectedPattern, ok := expectedPatterns[scenario.PATTERN]
+		if !ok {
+			expectedPattern = scenario.Wd()
+		}
+		require.Exactly(t, expectedPattern, scenario.Pattern(), sid)
+		args, err := scenario.SubjectArgs([]string{"cmd", "-pkg=" + gomodfuzz.PatternPlaceholder, gomodfuzz.PatternPlaceholder[1:]})
+		require.NoError(t, err, sid)
+		require.Exactly(t, []string{"cmd", "-pkg=" + expectedPattern, gomodfuzz.PatternPlaceholder[1:]}, args, sid)
+
+		require.NoError(t, scenario.BeforeRun(stage), sid)
+
+		// Each form names the same package.
+		res, err := scenario.Run(context.Background(), []string{"go", "list", "-f", "{{.ImportPath}}", gomodfuzz.PatternPlaceholder})
+		require.NoError(t, err, sid)
+		require.NoError(t, res.Err, sid+" "+res.Stderr)
+		require.Exactly(t, "wd/pkg", res.Stdout, sid)
+	}
+}
+
+func (s *ScenarioSuite) TestRunTemplate() {
+	t := s.T()
+
+	rootDir := filepath.Join(testkit_file.DynamicDataDirAbs(t), "template")
+	stage := cage_file_stage.NewStage(rootDir)
+
+	config := gomodfuzz.Config{
+		Env: []string{
+			"GOMODFUZZ_TEST_OUT={{.ScenarioDir}}/out.json",
+			"GOMODFUZZ_TEST_MODE={{.GO111MODULE}}",
+			"GOPATH=overridden", // permutation-defined variables take precedence
+		},
+		TemplateArgs: true,
+		TemplateEnv:  true,
+	}
+
+	script := `echo "$0|$1|$GOMODFUZZ_TEST_OUT|$GOMODFUZZ_TEST_MODE|$GOPATH"`
+	args := []string{"sh", "-c", script, "--root={{.Wd}}", "{{.ModulePath}}"}
+
+	for _, scenario := range s.permuteCanonical(cage_exec.CommonExecutor{}, rootDir, config) {
+		sid := scenario.String()
+
+		require.NoError(t, scenario.BeforeRun(stage), sid)
+
+		res, err := scenario.Run(context.Background(), args)
+		require.NoError(t, err, sid)
+		require.NoError(t, res.Err, sid+" "+res.Stderr)
+
+		expected := []string{
+			"--root=" + scenario.Wd(),
+			scenario.ModulePath(),
+			scenario.ScenarioDir() + "/out.json",
+			scenario.GO111MODULE,
+			scenario.Gopath(),
+		}
+		require.Exactly(t, strings.Join(expected, "|"), res.Stdout, sid)
+
+		_, err = scenario.Run(context.Background(), []string{"echo", "{{.Undefined}}"})
+		require.Error(t, err, sid)
+		require.Contains(t, err.Error(), "can't evaluate field Undefined", sid)
+	}
+
+	// Arguments and variables are not expanded unless enabled, e.g. so `go list -f` templates are passed as-is.
+	verbatimEnv := []string{"GOMODFUZZ_TEST_FMT={{.Dir}}"}
+	verbatim := gomodfuzz.NewScenario(cage_exec.CommonExecutor{}, rootDir, gomodfuzz.Config{Env: verbatimEnv})
+	verbatimArgs, err := verbatim.SubjectArgs(args)
+	require.NoError(t, err)
+	require.Exactly(t, args, verbatimArgs)
+	extraEnv, err := verbatim.ExtraEnv()
+	require.NoError(t, err)
+	require.Exactly(t, verbatimEnv, extraEnv)
+}
+
+func (s *ScenarioSuite) TestRunSubjectReport() {
+	t := s.T()
+
+	rootDir := filepath.Join(testkit_file.DynamicDataDirAbs(t), "subject_report")
+	stage := cage_file_stage.NewStage(rootDir)
+
+	for _, scenario := range s.permuteCanonical(cage_exec.CommonExecutor{}, rootDir, gomodfuzz.Config{}) {
+		sid := scenario.String()
+
+		require.NoError(t, scenario.BeforeRun(stage), sid)
+
+		report := `{"pass": true, "checks": [{"name": "a", "pass": true}, {"name": "b", "pass": false, "message": "m"}], "metrics": {"y": 2, "x": 1.5}}`
+		script := `printf '%s\n%s' "$GOMODFUZZ_SCENARIO_ID" "$GOMODFUZZ_AXES"; printf '%s' "$0" > "$GOMODFUZZ_RESULT_FILE"`
+		res, err := scenario.Run(context.Background(), []string{"sh", "-c", script, report})
+		require.NoError(t, err, sid)
+		require.NoError(t, res.Err, sid+" "+res.Stderr)
+
+		lines := strings.Split(res.Stdout, "\n")
+		require.Len(t, lines, 2, sid)
+		require.Exactly(t, strconv.Itoa(scenario.Id()), lines[0], sid)
+		var axes map[string]string
+		require.NoError(t, json.Unmarshal([]byte(lines[1]), &axes), sid)
+		require.Exactly(t, scenario.AxisLabels(), axes, sid)
+
+		require.Exactly(t, gomodfuzz.CheckFailOutcome, res.Outcome, sid)
+		require.NotNil(t, res.Report, sid)
+		require.True(t, *res.Report.Pass, sid)
+		require.True(t, res.Report.Failed(), sid)
+		require.Exactly(t, []gomodfuzz.SubjectCheck{{Name: "b", Pass: false, Message: "m"}}, res.Report.FailedChecks(), sid)
+		require.Exactly(t, []string{"x", "y"}, res.Report.MetricNames(), sid)
+		require.Exactly(t, 1.5, res.Report.Metrics["x"], sid)
+
+		// A report from the previous run is not reused.
+		res, err = scenario.Run(context.Background(), []string{"true"})
+		require.NoError(t, err, sid)
+		require.Nil(t, res.Report, sid)
+		require.Exactly(t, gomodfuzz.PassOutcome, res.Outcome, sid)
+
+		res, err = scenario.Run(context.Background(), []string{"sh", "-c", `printf '{"passed": true}' > "$GOMODFUZZ_RESULT_FILE"`})
+		require.NoError(t, err, sid)
+		require.Nil(t, res.Report, sid)
+		require.Exactly(t, gomodfuzz.ErrorOutcome, res.Outcome, sid)
+		require.Contains(t, res.Err.Error(), `unknown field "passed"`, sid)
+
+		res, err = scenario.Run(context.Background(), []string{"sh", "-c", `printf '{"pass": false}' > "$GOMODFUZZ_RESULT_FILE"`})
+		require.NoError(t, err, sid)
+		require.Exactly(t, gomodfuzz.CheckFailOutcome, res.Outcome, sid)
+	}
+}
+
 func TestScenarioSuite(t *testing.T) {
 	suite.Run(t, new(ScenarioSuite))
 }
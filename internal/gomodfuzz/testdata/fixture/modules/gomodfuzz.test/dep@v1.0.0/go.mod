@@ -0,0 +1 @@
+module gomodfuzz.test/dep
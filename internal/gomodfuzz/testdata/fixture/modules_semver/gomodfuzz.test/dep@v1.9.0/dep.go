@@ -0,0 +1,5 @@
+// Package dep is a fixture module dependency.
+package dep
+
+// Version identifies which version of the module was loaded.
+const Version = "v1.9.0"
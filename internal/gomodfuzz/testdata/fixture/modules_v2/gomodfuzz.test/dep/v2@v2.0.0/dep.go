@@ -0,0 +1,5 @@
+// Package dep is a fixture module dependency with a major version suffix.
+package dep
+
+// Version identifies which version of the module was loaded.
+const Version = "v2.0.0"
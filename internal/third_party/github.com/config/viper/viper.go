@@ -24,6 +24,7 @@ import (
 // Changes:
 //
 // - Add stringSlice support from https://github.com/spf13/viper.
+// - Add stringArray support.
 func MergeConfig(fs *pflag.FlagSet, v *std_viper.Viper) (lastErr error) {
 	fs.VisitAll(func(f *pflag.Flag) {
 		if f.Changed {
@@ -63,6 +64,19 @@ func MergeConfig(fs *pflag.FlagSet, v *std_viper.Viper) (lastErr error) {
 				lastErr = f.Value.Set(fmt.Sprintf("%v", viperValue)) // write back in expected format
 			}
 
+		case "stringArray":
+			// Viper reports an unchanged flag's value in its string form, e.g. "[]", rather than as a slice.
+			if v.GetString(f.Name) == flagValue {
+				break
+			}
+
+			// Unlike stringSlice, each Set call after the first appends one element as-is (no CSV parsing).
+			for _, elem := range v.GetStringSlice(f.Name) {
+				if err := f.Value.Set(elem); err != nil {
+					lastErr = err
+				}
+			}
+
 		case "int64", "int32", "int16", "int8", "int":
 			viperValue := strconv.FormatInt(int64(v.GetInt(f.Name)), 10)
 